@@ -0,0 +1,242 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package baggage propagates the key-value pairs stored in Context with
+// telemetry.KeyValuesToContext across process boundaries using the W3C Baggage
+// format (https://www.w3.org/TR/baggage/).
+package baggage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+const (
+	// Header is the name of the HTTP header holding the baggage.
+	Header = "baggage"
+
+	// maxMembers and maxBytes are the limits the W3C Baggage specification
+	// requires propagators to honor.
+	maxMembers = 180
+	maxBytes   = 8192
+)
+
+// Propagator serializes allow-listed Context key-value pairs into the W3C
+// baggage format and back. Only keys that have been explicitly allowed are
+// propagated, so internal or sensitive values don't leak to other services.
+type Propagator struct {
+	keys map[string]struct{}
+}
+
+// New returns a Propagator for the provided allow-list of keys.
+func New(keys ...string) *Propagator {
+	p := &Propagator{keys: make(map[string]struct{}, len(keys))}
+	for _, k := range keys {
+		p.keys[k] = struct{}{}
+	}
+	return p
+}
+
+// Inject adds the allow-listed key-value pairs found in Context to the baggage
+// header of the provided http.Header. Existing baggage members are preserved
+// unless their key is set from Context, as long as the header stays within the
+// limits of the W3C Baggage specification.
+func (p *Propagator) Inject(ctx context.Context, h http.Header) {
+	encoded := p.Encode(ctx)
+	if encoded == "" {
+		return
+	}
+
+	// encoded values have commas escaped
+	members := strings.Split(encoded, ",")
+	overridden := make(map[string]struct{}, len(members))
+	for _, m := range members {
+		if key, _, ok := parseMember(m); ok {
+			overridden[key] = struct{}{}
+		}
+	}
+	for _, m := range split(strings.Join(h.Values(Header), ",")) {
+		if key, _, ok := parseMember(m); ok {
+			if _, found := overridden[key]; found {
+				// overridden by the value found in Context
+				continue
+			}
+		}
+		members = append(members, m)
+	}
+	h.Set(Header, join(members))
+}
+
+// Extract returns a Context holding the allow-listed key-value pairs found in
+// the baggage header of the provided http.Header, making them available to
+// Loggers having access to the returned Context.
+func (p *Propagator) Extract(ctx context.Context, h http.Header) context.Context {
+	return p.Decode(ctx, strings.Join(h.Values(Header), ","))
+}
+
+// Encode serializes the allow-listed key-value pairs found in Context into the
+// W3C baggage format. If a key is found multiple times, the last value wins.
+func (p *Propagator) Encode(ctx context.Context) string {
+	var (
+		keyValuePairs = telemetry.KeyValuesFromContext(ctx)
+		order         []string
+		values        = make(map[string]string)
+	)
+	for i := 0; i+1 < len(keyValuePairs); i += 2 {
+		key, ok := keyValuePairs[i].(string)
+		if !ok || !p.allowed(key) || !isToken(key) {
+			continue
+		}
+		if _, seen := values[key]; !seen {
+			order = append(order, key)
+		}
+		values[key] = fmt.Sprint(keyValuePairs[i+1])
+	}
+
+	members := make([]string, 0, len(order))
+	for _, key := range order {
+		members = append(members, key+"="+escape(values[key]))
+	}
+	return join(members)
+}
+
+// Decode parses the provided W3C baggage value and returns a Context holding
+// the allow-listed key-value pairs. Malformed members are skipped and members
+// beyond the limits of the W3C Baggage specification are dropped.
+func (p *Propagator) Decode(ctx context.Context, baggage string) context.Context {
+	var (
+		keyValuePairs []interface{}
+		end, count    int
+	)
+	for _, m := range strings.Split(baggage, ",") {
+		if end += len(m); end > maxBytes || count == maxMembers {
+			break
+		}
+		end++
+		if m = strings.TrimSpace(m); m == "" {
+			continue
+		}
+		count++
+		key, value, ok := parseMember(m)
+		if !ok || !p.allowed(key) {
+			continue
+		}
+		keyValuePairs = append(keyValuePairs, key, value)
+	}
+	return telemetry.KeyValuesToContext(ctx, keyValuePairs...)
+}
+
+func (p *Propagator) allowed(key string) bool {
+	_, ok := p.keys[key]
+	return ok
+}
+
+// join returns the comma separated list of the members fitting within the
+// maximum number of members and bytes, dropping the ones beyond.
+func join(members []string) string {
+	var sb strings.Builder
+	for i, m := range members {
+		if i == maxMembers || sb.Len()+len(m)+1 > maxBytes {
+			break
+		}
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(m)
+	}
+	return sb.String()
+}
+
+// split returns the non-empty list members of a baggage value.
+func split(baggage string) []string {
+	var members []string
+	for _, m := range strings.Split(baggage, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			members = append(members, m)
+		}
+	}
+	return members
+}
+
+// parseMember parses a single list member, discarding any properties.
+func parseMember(member string) (key, value string, ok bool) {
+	if i := strings.IndexByte(member, ';'); i >= 0 {
+		member = member[:i]
+	}
+	i := strings.IndexByte(member, '=')
+	if i < 0 {
+		return "", "", false
+	}
+	key = strings.TrimSpace(member[:i])
+	if !isToken(key) {
+		return "", "", false
+	}
+	value, err := url.PathUnescape(strings.TrimSpace(member[i+1:]))
+	if err != nil {
+		return "", "", false
+	}
+	return key, value, true
+}
+
+// escape percent-encodes all characters not allowed as baggage-octet.
+func escape(value string) string {
+	const hex = "0123456789ABCDEF"
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if isBaggageOctet(c) {
+			sb.WriteByte(c)
+			continue
+		}
+		sb.WriteByte('%')
+		sb.WriteByte(hex[c>>4])
+		sb.WriteByte(hex[c&0x0f])
+	}
+	return sb.String()
+}
+
+// isBaggageOctet reports whether c may be used unescaped in a baggage value.
+func isBaggageOctet(c byte) bool {
+	if c == '%' {
+		// allowed by the grammar but escaped to keep decoding unambiguous
+		return false
+	}
+	return c == 0x21 ||
+		(c >= 0x23 && c <= 0x2b) ||
+		(c >= 0x2d && c <= 0x3a) ||
+		(c >= 0x3c && c <= 0x5b) ||
+		(c >= 0x5d && c <= 0x7e)
+}
+
+// isToken reports whether s is a valid RFC 7230 token.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
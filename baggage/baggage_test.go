@@ -0,0 +1,155 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package baggage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+func TestEncode(t *testing.T) {
+	p := New("x-request-id", "tenant", "count")
+
+	tests := []struct {
+		name          string
+		keyValuePairs []interface{}
+		expected      string
+	}{
+		{"empty", nil, ""},
+		{"not-allowed", []interface{}{"secret", "value"}, ""},
+		{"allowed", []interface{}{"x-request-id", "abc", "secret", "value", "tenant", "acme"}, "x-request-id=abc,tenant=acme"},
+		{"last-wins", []interface{}{"tenant", "a", "tenant", "b"}, "tenant=b"},
+		{"non-string", []interface{}{"count", 42, 1, "one"}, "count=42"},
+		{"escaped", []interface{}{"tenant", "a b,c;d=%"}, "tenant=a%20b%2Cc%3Bd=%25"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := telemetry.KeyValuesToContext(context.Background(), tt.keyValuePairs...)
+			if have := p.Encode(ctx); have != tt.expected {
+				t.Fatalf("Encode()=%q, want: %q", have, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	p := New("x-request-id", "tenant")
+
+	tests := []struct {
+		name     string
+		baggage  string
+		expected []interface{}
+	}{
+		{"empty", "", nil},
+		{"not-allowed", "secret=value", nil},
+		{"allowed", " x-request-id = abc , secret=value,tenant=acme;prop=1", []interface{}{"x-request-id", "abc", "tenant", "acme"}},
+		{"escaped", "tenant=a%20b%2Cc", []interface{}{"tenant", "a b,c"}},
+		{"malformed", "tenant,x-request-id=%zz,=b,tenant=ok", []interface{}{"tenant", "ok"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			have := telemetry.KeyValuesFromContext(p.Decode(context.Background(), tt.baggage))
+			if !reflect.DeepEqual(have, tt.expected) {
+				t.Fatalf("Decode()=%v, want: %v", have, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	p := New("key")
+	var keyValuePairs []interface{}
+	for i := 0; i < 2*maxMembers; i++ {
+		p.keys[strings.Repeat("k", i+1)] = struct{}{}
+		keyValuePairs = append(keyValuePairs, strings.Repeat("k", i+1), "v")
+	}
+	encoded := p.Encode(telemetry.KeyValuesToContext(context.Background(), keyValuePairs...))
+	if len(encoded) > maxBytes {
+		t.Fatalf("len(Encode())=%d, want <= %d", len(encoded), maxBytes)
+	}
+	if n := len(strings.Split(encoded, ",")); n > maxMembers {
+		t.Fatalf("members=%d, want <= %d", n, maxMembers)
+	}
+
+	// members crossing the limit are dropped instead of being truncated
+	p = New("key", "tenant")
+	fits := "key=" + strings.Repeat("v", maxBytes-len("key=")-len(",tenant=acme"))
+	have := telemetry.KeyValuesFromContext(p.Decode(context.Background(), fits+",tenant=acme"))
+	if len(have) != 4 || have[3] != "acme" {
+		t.Fatalf("Decode()=%d key-values, want: 4", len(have))
+	}
+	have = telemetry.KeyValuesFromContext(p.Decode(context.Background(), fits+"v,tenant=acme"))
+	if len(have) != 2 || have[0] != "key" {
+		t.Fatalf("Decode()=%d key-values, want: 2", len(have))
+	}
+
+	h := http.Header{}
+	h.Set(Header, strings.Repeat("a", maxBytes-10)+"=1,other=1")
+	p.Inject(telemetry.KeyValuesToContext(context.Background(), "tenant", "acme"), h)
+	if injected := h.Get(Header); injected != "tenant=acme" {
+		t.Fatalf("Inject()=%.20q, want: %q", injected, "tenant=acme")
+	}
+}
+
+func TestInjectPreservesMembers(t *testing.T) {
+	p := New("tenant", "user")
+	h := http.Header{}
+	h.Set(Header, "user=jane,tenant=stale,other=1")
+
+	p.Inject(telemetry.KeyValuesToContext(context.Background(), "tenant", "acme"), h)
+	if injected := h.Get(Header); injected != "tenant=acme,user=jane,other=1" {
+		t.Fatalf("Inject()=%q, want: %q", injected, "tenant=acme,user=jane,other=1")
+	}
+}
+
+func TestHTTPRoundTrip(t *testing.T) {
+	p := New("x-request-id", "tenant")
+
+	var received []interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = telemetry.KeyValuesFromContext(p.Extract(r.Context(), r.Header))
+		if !strings.Contains(r.Header.Get(Header), "other=1") {
+			t.Errorf("existing baggage member was not preserved: %q", r.Header.Get(Header))
+		}
+	}))
+	defer srv.Close()
+
+	ctx := telemetry.KeyValuesToContext(context.Background(), "x-request-id", "abc", "tenant", "acme", "secret", "s3cr3t")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(Header, "tenant=stale,other=1")
+	p.Inject(ctx, req.Header)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+
+	expected := []interface{}{"x-request-id", "abc", "tenant", "acme"}
+	if !reflect.DeepEqual(received, expected) {
+		t.Fatalf("received %v, want: %v", received, expected)
+	}
+}
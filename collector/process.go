@@ -0,0 +1,221 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+const (
+	// DefaultProcRoot is the default mount point of the proc filesystem.
+	DefaultProcRoot = "/proc"
+
+	// userHZ is the number of clock ticks per second used by /proc/[pid]/stat.
+	// It is fixed at 100 on all architectures supported by Linux user space.
+	userHZ = 100
+)
+
+// procfs reads process statistics of the current process from a proc
+// filesystem mounted at root.
+type procfs struct {
+	root string
+}
+
+// processStat holds the /proc/[pid]/stat fields of interest.
+type processStat struct {
+	cpuSeconds    float64
+	threads       float64
+	startTicks    float64
+	virtualMemory float64
+	residentPages float64
+}
+
+// RegisterProcess registers derived gauges for statistics of the current
+// process as found in the Linux proc filesystem mounted at root. If root is
+// empty, DefaultProcRoot is used. Providing root allows for using a fake
+// procfs directory, e.g. in tests. An error is returned if the process
+// statistics can't be read, in which case no gauges are registered.
+// The cumulative CPU time is registered as a derived sum if the sink implements
+// telemetry.DerivedSumSink and as a derived gauge otherwise.
+func RegisterProcess(sink telemetry.DerivedMetricSink, root string) ([]Gauge, error) {
+	if root == "" {
+		root = DefaultProcRoot
+	}
+	fs := procfs{root: root}
+	if _, err := fs.stat(); err != nil {
+		return nil, err
+	}
+	bootTime, err := fs.bootTime()
+	if err != nil {
+		return nil, err
+	}
+
+	stat := func(field func(processStat) float64) func() float64 {
+		return func() float64 {
+			s, serr := fs.stat()
+			if serr != nil {
+				return 0
+			}
+			return field(s)
+		}
+	}
+	pageSize := float64(os.Getpagesize())
+
+	gauges := []struct {
+		Gauge
+		value func() float64
+	}{
+		{
+			Gauge{"process_cpu_seconds_total", "Total user and system CPU time spent", telemetry.Seconds},
+			stat(func(s processStat) float64 { return s.cpuSeconds }),
+		},
+		{
+			Gauge{"process_resident_memory_bytes", "Resident memory size", telemetry.Bytes},
+			stat(func(s processStat) float64 { return s.residentPages * pageSize }),
+		},
+		{
+			Gauge{"process_virtual_memory_bytes", "Virtual memory size", telemetry.Bytes},
+			stat(func(s processStat) float64 { return s.virtualMemory }),
+		},
+		{
+			Gauge{"process_threads", "Number of OS threads", telemetry.None},
+			stat(func(s processStat) float64 { return s.threads }),
+		},
+		{
+			Gauge{"process_start_time_seconds", "Start time of the process since the Unix epoch", telemetry.Seconds},
+			stat(func(s processStat) float64 { return bootTime + s.startTicks/userHZ }),
+		},
+		{
+			Gauge{"process_open_fds", "Number of open file descriptors", telemetry.None},
+			func() float64 {
+				n, _ := fs.openFDs()
+				return n
+			},
+		},
+		{
+			Gauge{"process_max_fds", "Soft limit of open file descriptors", telemetry.None},
+			func() float64 {
+				n, _ := fs.maxFDs()
+				return n
+			},
+		},
+	}
+
+	registered := make([]Gauge, 0, len(gauges))
+	for _, g := range gauges {
+		// Cumulative statistics are named with the _total suffix.
+		if strings.HasSuffix(g.Name, "_total") {
+			registerSum(sink, g.Gauge, g.value)
+		} else {
+			sink.NewDerivedGauge(g.Name, g.Description).ValueFrom(g.value)
+		}
+		registered = append(registered, g.Gauge)
+	}
+	return registered, nil
+}
+
+func (fs procfs) path(elem ...string) string {
+	return filepath.Join(append([]string{fs.root}, elem...)...)
+}
+
+// stat parses /proc/self/stat.
+func (fs procfs) stat() (processStat, error) {
+	data, err := os.ReadFile(fs.path("self", "stat"))
+	if err != nil {
+		return processStat{}, err
+	}
+	// The command name is enclosed in parentheses and may hold spaces and
+	// parentheses itself, so split after the last closing one.
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return processStat{}, fmt.Errorf("malformed %s", fs.path("self", "stat"))
+	}
+	// fields[0] holds field 3 (state) as documented in proc(5).
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 22 {
+		return processStat{}, fmt.Errorf("malformed %s: %d fields", fs.path("self", "stat"), len(fields))
+	}
+	field := func(n int) float64 {
+		v, _ := strconv.ParseFloat(fields[n-3], 64)
+		return v
+	}
+	return processStat{
+		cpuSeconds:    (field(14) + field(15)) / userHZ,
+		threads:       field(20),
+		startTicks:    field(22),
+		virtualMemory: field(23),
+		residentPages: field(24),
+	}, nil
+}
+
+// bootTime returns the system boot time in seconds since the Unix epoch as
+// found in /proc/stat.
+func (fs procfs) bootTime() (float64, error) {
+	f, err := os.Open(fs.path("stat"))
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == "btime" {
+			return strconv.ParseFloat(fields[1], 64)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("btime not found in %s", fs.path("stat"))
+}
+
+// openFDs returns the number of entries in /proc/self/fd.
+func (fs procfs) openFDs() (float64, error) {
+	entries, err := os.ReadDir(fs.path("self", "fd"))
+	if err != nil {
+		return 0, err
+	}
+	return float64(len(entries)), nil
+}
+
+// maxFDs returns the soft limit of open files found in /proc/self/limits.
+func (fs procfs) maxFDs() (float64, error) {
+	data, err := os.ReadFile(fs.path("self", "limits"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "Max open files") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "Max open files"))
+		if len(fields) == 0 {
+			break
+		}
+		if fields[0] == "unlimited" {
+			return -1, nil
+		}
+		return strconv.ParseFloat(fields[0], 64)
+	}
+	return 0, fmt.Errorf("max open files not found in %s", fs.path("self", "limits"))
+}
@@ -0,0 +1,124 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/metrictest"
+)
+
+func TestRegisterProcess(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"stat": "cpu  1 2 3 4\nbtime 1600000000\nprocesses 42\n",
+		"self/stat": "1234 (my (weird) cmd) S 1 1234 1234 0 -1 4194560 100 0 0 0 " +
+			"250 50 0 0 20 0 12 0 500 104857600 2560 18446744073709551615\n",
+		"self/limits": "Limit                     Soft Limit           Hard Limit           Units\n" +
+			"Max cpu time              unlimited            unlimited            seconds\n" +
+			"Max open files            1024                 4096                 files\n",
+	}
+	for name, content := range files {
+		writeFile(t, filepath.Join(root, name), content)
+	}
+	for i := 0; i < 3; i++ {
+		writeFile(t, filepath.Join(root, "self", "fd", strconv.Itoa(i)), "")
+	}
+
+	sink := metrictest.NewSink(t)
+	gauges, err := RegisterProcess(sink, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gauges) != 7 {
+		t.Fatalf("registered %d gauges, want 7", len(gauges))
+	}
+
+	sink.ExpectSum("process_cpu_seconds_total", nil).Equals(3)
+	if sink.Unit("process_cpu_seconds_total") != telemetry.Seconds {
+		t.Errorf("process_cpu_seconds_total: unit=%q, want: %q", sink.Unit("process_cpu_seconds_total"), telemetry.Seconds)
+	}
+	sink.ExpectGauge("process_resident_memory_bytes", nil).Equals(float64(2560 * os.Getpagesize()))
+	sink.ExpectGauge("process_virtual_memory_bytes", nil).Equals(104857600)
+	sink.ExpectGauge("process_threads", nil).Equals(12)
+	sink.ExpectGauge("process_start_time_seconds", nil).Equals(1600000005)
+	sink.ExpectGauge("process_open_fds", nil).Equals(3)
+	sink.ExpectGauge("process_max_fds", nil).Equals(1024)
+
+	// values are read on each export
+	writeFile(t, filepath.Join(root, "self", "fd", "3"), "")
+	sink.ExpectGauge("process_open_fds", nil).Equals(4)
+}
+
+func TestRegisterProcessWithoutSums(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "stat"), "btime 1600000000\n")
+	writeFile(t, filepath.Join(root, "self", "stat"), "1234 (cmd) S 1 2 3 4 5 6 7 8 9 10 250 50 14 15 16 17 18 19 20 21 22")
+
+	sink := metrictest.NewSink(t)
+	if _, err := RegisterProcess(struct{ telemetry.DerivedMetricSink }{sink}, root); err != nil {
+		t.Fatal(err)
+	}
+	sink.ExpectGauge("process_cpu_seconds_total", nil).Equals(3)
+}
+
+func TestRegisterProcessErrors(t *testing.T) {
+	root := t.TempDir()
+	sink := metrictest.NewSink(t)
+	if _, err := RegisterProcess(sink, root); err == nil {
+		t.Fatal("expected error on missing stat file")
+	}
+
+	writeFile(t, filepath.Join(root, "self", "stat"), "1234 (cmd S 1")
+	if _, err := RegisterProcess(sink, root); err == nil {
+		t.Fatal("expected error on malformed stat file")
+	}
+
+	writeFile(t, filepath.Join(root, "self", "stat"), "1234 (cmd) S 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20 21 22")
+	writeFile(t, filepath.Join(root, "stat"), "cpu 1 2 3\n")
+	if _, err := RegisterProcess(sink, root); err == nil {
+		t.Fatal("expected error on missing btime")
+	}
+}
+
+func TestRegisterProcessLinux(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("proc filesystem only available on Linux")
+	}
+	sink := metrictest.NewSink(t)
+	if _, err := RegisterProcess(sink, ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"process_resident_memory_bytes", "process_threads", "process_open_fds", "process_start_time_seconds"} {
+		if v := sink.ExpectGauge(name, nil).Values(); len(v) != 1 || v[0] <= 0 {
+			t.Errorf("%s: unexpected values %v", name, v)
+		}
+	}
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package collector provides collectors registering derived gauges for
+// commonly monitored Go runtime and process statistics through a
+// telemetry.DerivedMetricSink.
+package collector
+
+import (
+	"math"
+	"runtime"
+	"runtime/metrics"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+// Gauge describes a derived gauge registered by a collector. As derived gauges
+// don't carry a unit, the unit is also reflected by the Gauge name suffix.
+type Gauge struct {
+	// Name of the derived gauge.
+	Name string
+	// Description of the derived gauge.
+	Description string
+	// Unit of the values provided by the derived gauge.
+	Unit telemetry.Unit
+}
+
+// runtimeGauge maps a runtime/metrics sample to a derived gauge. If multiple
+// samples are listed, the first one supported by the Go runtime is used.
+// Cumulative samples are registered as derived sums.
+type runtimeGauge struct {
+	Gauge
+	samples []string
+	value   func(metrics.Value) float64
+	sum     bool
+}
+
+var runtimeGauges = []runtimeGauge{
+	{
+		Gauge:   Gauge{"go_goroutines", "Number of live goroutines", telemetry.None},
+		samples: []string{"/sched/goroutines:goroutines"},
+		value:   uint64Value,
+	},
+	{
+		Gauge:   Gauge{"go_gomaxprocs", "Current GOMAXPROCS setting", telemetry.None},
+		samples: []string{"/sched/gomaxprocs:threads"},
+		value:   uint64Value,
+	},
+	{
+		Gauge:   Gauge{"go_memory_total_bytes", "All memory mapped by the Go runtime into the current process", telemetry.Bytes},
+		samples: []string{"/memory/classes/total:bytes"},
+		value:   uint64Value,
+	},
+	{
+		Gauge:   Gauge{"go_heap_objects_bytes", "Memory occupied by live objects and dead objects not yet freed by the GC", telemetry.Bytes},
+		samples: []string{"/memory/classes/heap/objects:bytes"},
+		value:   uint64Value,
+	},
+	{
+		Gauge:   Gauge{"go_heap_objects", "Number of objects, live or unswept, occupying heap memory", telemetry.None},
+		samples: []string{"/gc/heap/objects:objects"},
+		value:   uint64Value,
+	},
+	{
+		Gauge:   Gauge{"go_heap_allocs_bytes_total", "Cumulative sum of memory allocated to the heap", telemetry.Bytes},
+		samples: []string{"/gc/heap/allocs:bytes"},
+		value:   uint64Value,
+		sum:     true,
+	},
+	{
+		Gauge:   Gauge{"go_heap_goal_bytes", "Heap size target for the end of the GC cycle", telemetry.Bytes},
+		samples: []string{"/gc/heap/goal:bytes"},
+		value:   uint64Value,
+	},
+	{
+		Gauge:   Gauge{"go_gc_cycles_total", "Count of all completed GC cycles", telemetry.None},
+		samples: []string{"/gc/cycles/total:gc-cycles"},
+		value:   uint64Value,
+		sum:     true,
+	},
+	{
+		Gauge:   Gauge{"go_gc_pauses_p50_seconds", "Median stop-the-world GC pause latency since process start", telemetry.Seconds},
+		samples: []string{"/sched/pauses/total/gc:seconds", "/gc/pauses:seconds"},
+		value:   quantileValue(0.5),
+	},
+	{
+		Gauge:   Gauge{"go_gc_pauses_p99_seconds", "99th percentile stop-the-world GC pause latency since process start", telemetry.Seconds},
+		samples: []string{"/sched/pauses/total/gc:seconds", "/gc/pauses:seconds"},
+		value:   quantileValue(0.99),
+	},
+	{
+		Gauge:   Gauge{"go_gc_pauses_max_seconds", "Maximum stop-the-world GC pause latency since process start", telemetry.Seconds},
+		samples: []string{"/sched/pauses/total/gc:seconds", "/gc/pauses:seconds"},
+		value:   quantileValue(1),
+	},
+	{
+		Gauge:   Gauge{"go_sched_latencies_p50_seconds", "Median time goroutines spent runnable before running since process start", telemetry.Seconds},
+		samples: []string{"/sched/latencies:seconds"},
+		value:   quantileValue(0.5),
+	},
+	{
+		Gauge:   Gauge{"go_sched_latencies_p99_seconds", "99th percentile time goroutines spent runnable before running since process start", telemetry.Seconds},
+		samples: []string{"/sched/latencies:seconds"},
+		value:   quantileValue(0.99),
+	},
+	{
+		Gauge:   Gauge{"go_sched_latencies_max_seconds", "Maximum time goroutines spent runnable before running since process start", telemetry.Seconds},
+		samples: []string{"/sched/latencies:seconds"},
+		value:   quantileValue(1),
+	},
+}
+
+// RegisterRuntime registers derived gauges for Go runtime statistics using
+// runtime/metrics. Cumulative statistics are registered as derived sums if the
+// sink implements telemetry.DerivedSumSink and fall back to derived gauges
+// otherwise. Gauges backed by samples the running Go version doesn't support
+// are skipped.
+// The registered Gauges are returned.
+func RegisterRuntime(sink telemetry.DerivedMetricSink) []Gauge {
+	supported := make(map[string]bool)
+	for _, d := range metrics.All() {
+		supported[d.Name] = true
+	}
+
+	var registered []Gauge
+	for _, g := range runtimeGauges {
+		sample := ""
+		for _, s := range g.samples {
+			if supported[s] {
+				sample = s
+				break
+			}
+		}
+		if sample == "" {
+			if g.Name != "go_gomaxprocs" {
+				continue
+			}
+			// GOMAXPROCS is only exposed through runtime/metrics since Go 1.20.
+			sink.NewDerivedGauge(g.Name, g.Description).
+				ValueFrom(func() float64 { return float64(runtime.GOMAXPROCS(0)) })
+			registered = append(registered, g.Gauge)
+			continue
+		}
+
+		value := g.value
+		valueFn := func() float64 {
+			s := []metrics.Sample{{Name: sample}}
+			metrics.Read(s)
+			return value(s[0].Value)
+		}
+		if g.sum {
+			registerSum(sink, g.Gauge, valueFn)
+		} else {
+			sink.NewDerivedGauge(g.Name, g.Description).ValueFrom(valueFn)
+		}
+		registered = append(registered, g.Gauge)
+	}
+	return registered
+}
+
+// registerSum registers a derived sum for the cumulative value provided by
+// valueFn. Sinks not implementing telemetry.DerivedSumSink get a derived gauge
+// instead, so the value is still exported, albeit without counter semantics.
+func registerSum(sink telemetry.DerivedMetricSink, g Gauge, valueFn func() float64) {
+	if sums, ok := sink.(telemetry.DerivedSumSink); ok {
+		sums.NewDerivedSum(g.Name, g.Description, telemetry.WithUnit(g.Unit)).ValueFrom(valueFn)
+		return
+	}
+	sink.NewDerivedGauge(g.Name, g.Description).ValueFrom(valueFn)
+}
+
+func uint64Value(v metrics.Value) float64 {
+	switch v.Kind() {
+	case metrics.KindUint64:
+		return float64(v.Uint64())
+	case metrics.KindFloat64:
+		return v.Float64()
+	default:
+		return 0
+	}
+}
+
+// quantileValue returns a function approximating the provided quantile of a
+// histogram sample by the upper bound of the bucket holding it.
+func quantileValue(q float64) func(metrics.Value) float64 {
+	return func(v metrics.Value) float64 {
+		if v.Kind() != metrics.KindFloat64Histogram {
+			return 0
+		}
+		h := v.Float64Histogram()
+		var total uint64
+		for _, c := range h.Counts {
+			total += c
+		}
+		if total == 0 {
+			return 0
+		}
+
+		rank := uint64(math.Ceil(q * float64(total)))
+		if rank == 0 {
+			rank = 1
+		}
+		var cumulative uint64
+		for i, c := range h.Counts {
+			cumulative += c
+			if cumulative >= rank {
+				// Buckets holds len(Counts)+1 boundaries.
+				if upper := h.Buckets[i+1]; !math.IsInf(upper, 1) {
+					return upper
+				}
+				return h.Buckets[i]
+			}
+		}
+		return 0
+	}
+}
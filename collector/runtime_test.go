@@ -0,0 +1,97 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"testing"
+
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/metrictest"
+)
+
+func TestRegisterRuntime(t *testing.T) {
+	sink := metrictest.NewSink(t)
+	gauges := RegisterRuntime(sink)
+	if len(gauges) < 10 {
+		t.Fatalf("registered %d gauges, want at least 10", len(gauges))
+	}
+
+	runtime.GC()
+	for _, g := range gauges {
+		expect := sink.ExpectGauge
+		if strings.HasSuffix(g.Name, "_total") {
+			expect = sink.ExpectSum
+			if sink.Unit(g.Name) != g.Unit {
+				t.Errorf("%s: unit=%q, want: %q", g.Name, sink.Unit(g.Name), g.Unit)
+			}
+		}
+		values := expect(g.Name, nil).Values()
+		if len(values) != 1 || values[0] < 0 {
+			t.Errorf("%s: unexpected values %v", g.Name, values)
+		}
+		if g.Unit == telemetry.Bytes && !strings.HasSuffix(g.Name, "_bytes") && !strings.HasSuffix(g.Name, "_bytes_total") {
+			t.Errorf("%s: name does not reflect unit %s", g.Name, g.Unit)
+		}
+		if g.Unit == telemetry.Seconds && !strings.HasSuffix(g.Name, "_seconds") {
+			t.Errorf("%s: name does not reflect unit %s", g.Name, g.Unit)
+		}
+	}
+
+	if values := sink.ExpectGauge("go_goroutines", nil).Values(); len(values) != 1 || values[0] < 1 {
+		t.Errorf("go_goroutines: unexpected values %v", values)
+	}
+	sink.ExpectGauge("go_gomaxprocs", nil).Equals(float64(runtime.GOMAXPROCS(0)))
+}
+
+func TestRegisterRuntimeWithoutSums(t *testing.T) {
+	sink := metrictest.NewSink(t)
+	var sums int
+	for _, g := range RegisterRuntime(struct{ telemetry.DerivedMetricSink }{sink}) {
+		if !strings.HasSuffix(g.Name, "_total") {
+			continue
+		}
+		sums++
+		if values := sink.ExpectGauge(g.Name, nil).Values(); len(values) != 1 || values[0] < 0 {
+			t.Errorf("%s: unexpected gauge fallback values %v", g.Name, values)
+		}
+	}
+	if sums != 2 {
+		t.Fatalf("registered %d cumulative gauges, want: 2", sums)
+	}
+}
+
+func TestQuantileValue(t *testing.T) {
+	var (
+		empty metrics.Sample
+		s     = []metrics.Sample{{Name: "/sched/latencies:seconds"}}
+	)
+	metrics.Read(s)
+	if v := quantileValue(0.5)(empty.Value); v != 0 {
+		t.Fatalf("quantile of unsupported value=%v, want 0", v)
+	}
+	h := s[0].Value.Float64Histogram()
+	if len(h.Counts) == 0 {
+		t.Skip("no scheduler latency histogram available")
+	}
+
+	p50, p99, maximum := quantileValue(0.5)(s[0].Value), quantileValue(0.99)(s[0].Value), quantileValue(1)(s[0].Value)
+	if p50 > p99 || p99 > maximum || math.IsInf(maximum, 0) {
+		t.Fatalf("unexpected quantiles p50=%v p99=%v max=%v", p50, p99, maximum)
+	}
+}
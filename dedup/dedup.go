@@ -0,0 +1,388 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dedup provides a telemetry.Logger decorator collapsing identical log
+// lines occurring within a time window into a single annotated log line.
+package dedup
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+// DefaultWindow is the default time window in which identical log lines are
+// collapsed.
+const DefaultWindow = 5 * time.Second
+
+// Keys added to the log line summarizing collapsed log lines.
+const (
+	RepeatedKey = "repeated"
+	FirstKey    = "first"
+	LastKey     = "last"
+)
+
+// Option implements a functional option type for the dedup Logger.
+type Option func(*options)
+
+type options struct {
+	window time.Duration
+	now    func() time.Time
+	// afterFunc schedules f to be called after d and returns a function
+	// canceling it.
+	afterFunc func(d time.Duration, f func()) (stop func() bool)
+}
+
+// WithWindow sets the time window in which identical log lines are collapsed.
+func WithWindow(window time.Duration) Option {
+	return func(o *options) {
+		o.window = window
+	}
+}
+
+// entry holds the state of a log line seen within the current window.
+type entry struct {
+	logger    telemetry.Logger
+	level     telemetry.Level
+	msg       string
+	err       error
+	keyValues []interface{}
+	count     int
+	first     time.Time
+	last      time.Time
+	stop      func() bool
+}
+
+// deduper holds the state shared by all Loggers derived from the same root
+// Logger.
+type deduper struct {
+	options
+	seed    maphash.Seed
+	mu      sync.Mutex
+	entries map[uint64]*entry
+}
+
+func newDeduper(o options) *deduper {
+	return &deduper{options: o, seed: maphash.MakeSeed(), entries: make(map[uint64]*entry)}
+}
+
+// id returns the hash identifying a log line.
+func (d *deduper) id(level telemetry.Level, msg string, err error, keyValues ...[]interface{}) uint64 {
+	var h maphash.Hash
+	h.SetSeed(d.seed)
+	hashValue(&h, int(level))
+	hashValue(&h, msg)
+	hashValue(&h, err)
+	for _, kvs := range keyValues {
+		for _, v := range kvs {
+			hashValue(&h, v)
+		}
+		_ = h.WriteByte(0)
+	}
+	return h.Sum64()
+}
+
+// hashValue writes v to the hash, prefixed with a byte identifying its kind.
+// Common types are written directly, other types are formatted.
+func hashValue(h *maphash.Hash, v interface{}) {
+	var b [8]byte
+	writeUint := func(kind byte, u uint64) {
+		_ = h.WriteByte(kind)
+		binary.LittleEndian.PutUint64(b[:], u)
+		_, _ = h.Write(b[:])
+	}
+	switch v := v.(type) {
+	case nil:
+		_ = h.WriteByte('n')
+	case string:
+		writeUint('s', uint64(len(v)))
+		_, _ = h.WriteString(v)
+	case error:
+		msg := v.Error()
+		writeUint('e', uint64(len(msg)))
+		_, _ = h.WriteString(msg)
+	case bool:
+		if v {
+			writeUint('b', 1)
+		} else {
+			writeUint('b', 0)
+		}
+	case int:
+		writeUint('i', uint64(v))
+	case int32:
+		writeUint('i', uint64(v))
+	case int64:
+		writeUint('i', uint64(v))
+	case uint:
+		writeUint('u', uint64(v))
+	case uint32:
+		writeUint('u', uint64(v))
+	case uint64:
+		writeUint('u', v)
+	case float64:
+		writeUint('f', math.Float64bits(v))
+	case time.Duration:
+		writeUint('d', uint64(v))
+	default:
+		s := fmt.Sprintf("%+v", v)
+		writeUint('v', uint64(len(s)))
+		_, _ = h.WriteString(s)
+	}
+}
+
+// seen registers the occurrence of a log line and returns true if an
+// identical log line was already written within the current window.
+func (d *deduper) seen(id uint64, e *entry) bool {
+	now := d.now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if existing, ok := d.entries[id]; ok {
+		existing.count++
+		existing.last = now
+		return true
+	}
+	// The key-value pairs are written with the summary log line after the
+	// call returned, so the caller may have reused their backing array.
+	e.keyValues = copyKeyValues(e.keyValues)
+	e.count, e.first, e.last = 1, now, now
+	e.stop = d.afterFunc(d.window, func() { d.flush(id) })
+	d.entries[id] = e
+	return false
+}
+
+// copyKeyValues returns a copy of the provided key-value pairs.
+func copyKeyValues(keyValues []interface{}) []interface{} {
+	if len(keyValues) == 0 {
+		return keyValues
+	}
+	return append(make([]interface{}, 0, len(keyValues)), keyValues...)
+}
+
+// flush ends the window of the identified log line, writing the summary log
+// line if identical log lines were collapsed.
+func (d *deduper) flush(id uint64) {
+	d.mu.Lock()
+	e, ok := d.entries[id]
+	delete(d.entries, id)
+	d.mu.Unlock()
+
+	if ok {
+		e.write()
+	}
+}
+
+// flushAll ends the windows of all tracked log lines.
+func (d *deduper) flushAll() {
+	d.mu.Lock()
+	entries := d.entries
+	d.entries = make(map[uint64]*entry)
+	d.mu.Unlock()
+
+	for _, e := range entries {
+		e.stop()
+		e.write()
+	}
+}
+
+// write writes the summary log line if identical log lines were collapsed.
+func (e *entry) write() {
+	if e.count < 2 {
+		return
+	}
+	keyValues := append(e.keyValues[:len(e.keyValues):len(e.keyValues)],
+		RepeatedKey, e.count, FirstKey, e.first, LastKey, e.last)
+	switch e.level {
+	case telemetry.LevelError:
+		e.logger.Error(e.msg, e.err, keyValues...)
+	case telemetry.LevelInfo:
+		e.logger.Info(e.msg, keyValues...)
+	default:
+		e.logger.Debug(e.msg, keyValues...)
+	}
+}
+
+// Logger is a telemetry.Logger collapsing identical log lines written to the
+// wrapped Logger.
+type Logger struct {
+	// logger holds the wrapped Logger, never having a Metric attached as the
+	// Metric is recorded by this Logger for each call.
+	logger telemetry.Logger
+	// ctx holds the Context to extract key-value pairs from to identify log
+	// lines and to record the Metric.
+	ctx context.Context
+	// args holds the key-value pairs added with With to identify log lines.
+	args []interface{}
+	// metric holds the Metric to increment each time Info() or Error() is called.
+	metric  telemetry.Metric
+	deduper *deduper
+}
+
+// compile time check for compatibility with the telemetry.Logger and
+// telemetry.CallerSkipper interfaces.
+var (
+	_ telemetry.Logger        = (*Logger)(nil)
+	_ telemetry.CallerSkipper = (*Logger)(nil)
+)
+
+// New returns a Logger collapsing identical log lines written to the provided
+// Logger. Log lines are identical if they have the same level, message, error
+// and key-value pairs, including the ones added with With and found in
+// Context.
+//
+// The first occurrence of a log line is written immediately and identical log
+// lines within the window are suppressed. At the end of the window the log
+// line is written again if it occurred more than once, annotated with the
+// total number of occurrences (RepeatedKey) and the times of the first
+// (FirstKey) and last (LastKey) occurrence.
+//
+// Levels are shared with the wrapped Logger. Attached Metrics are recorded for
+// every Info and Error call, including suppressed ones. Flush should be called
+// with the returned Logger before the program exits.
+func New(logger telemetry.Logger, opts ...Option) telemetry.Logger {
+	o := options{
+		window: DefaultWindow,
+		now:    time.Now,
+		afterFunc: func(d time.Duration, f func()) func() bool {
+			return time.AfterFunc(d, f).Stop
+		},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Logger{
+		logger:  telemetry.AddCallerSkip(logger, 1),
+		ctx:     context.Background(),
+		deduper: newDeduper(o),
+	}
+}
+
+// Debug emits a log message at debug level unless it is a duplicate.
+func (l *Logger) Debug(msg string, keyValues ...interface{}) {
+	if l.write(telemetry.LevelDebug, msg, nil, keyValues) {
+		l.logger.Debug(msg, keyValues...)
+	}
+}
+
+// Info emits a log message at info level unless it is a duplicate.
+func (l *Logger) Info(msg string, keyValues ...interface{}) {
+	l.record()
+	if l.write(telemetry.LevelInfo, msg, nil, keyValues) {
+		l.logger.Info(msg, keyValues...)
+	}
+}
+
+// Error emits a log message at error level unless it is a duplicate.
+func (l *Logger) Error(msg string, err error, keyValues ...interface{}) {
+	l.record()
+	if l.write(telemetry.LevelError, msg, err, keyValues) {
+		l.logger.Error(msg, err, keyValues...)
+	}
+}
+
+// write returns whether a log line should be written. Log lines disabled by
+// the configured level are not tracked.
+func (l *Logger) write(level telemetry.Level, msg string, err error, keyValues []interface{}) bool {
+	if level > l.logger.Level() {
+		return false
+	}
+	id := l.deduper.id(level, msg, err, telemetry.KeyValuesFromContext(l.ctx), l.args, keyValues)
+	return !l.deduper.seen(id, &entry{
+		logger:    l.logger,
+		level:     level,
+		msg:       msg,
+		err:       err,
+		keyValues: keyValues,
+	})
+}
+
+// record records the attached Metric, if any.
+func (l *Logger) record() {
+	if l.metric != nil {
+		l.metric.RecordContext(l.ctx, 1)
+	}
+}
+
+// Flush ends the windows of all tracked log lines, writing the summary log
+// lines of collapsed ones. It should be called before the program exits.
+func (l *Logger) Flush() { l.deduper.flushAll() }
+
+// Flush calls Flush on the provided Logger if it is a dedup Logger.
+func Flush(logger telemetry.Logger) {
+	if l, ok := logger.(*Logger); ok {
+		l.Flush()
+	}
+}
+
+// AddCallerSkip implements telemetry.CallerSkipper.
+func (l *Logger) AddCallerSkip(skip int) telemetry.Logger {
+	return &Logger{
+		logger:  telemetry.AddCallerSkip(l.logger, skip),
+		ctx:     l.ctx,
+		args:    l.args,
+		metric:  l.metric,
+		deduper: l.deduper,
+	}
+}
+
+// Level returns the logging level of the wrapped Logger.
+func (l *Logger) Level() telemetry.Level { return l.logger.Level() }
+
+// SetLevel configures the logging level of the wrapped Logger.
+func (l *Logger) SetLevel(level telemetry.Level) { l.logger.SetLevel(level) }
+
+// With returns Logger with provided key value pairs attached.
+func (l *Logger) With(keyValues ...interface{}) telemetry.Logger {
+	if len(keyValues) == 0 {
+		return l
+	}
+	return &Logger{
+		logger:  l.logger.With(keyValues...),
+		ctx:     l.ctx,
+		args:    append(l.args[:len(l.args):len(l.args)], keyValues...),
+		metric:  l.metric,
+		deduper: l.deduper,
+	}
+}
+
+// Context attaches provided Context to the Logger allowing metadata found in
+// this context to be used for log lines and metrics labels.
+func (l *Logger) Context(ctx context.Context) telemetry.Logger {
+	return &Logger{logger: l.logger.Context(ctx), ctx: ctx, args: l.args, metric: l.metric, deduper: l.deduper}
+}
+
+// Metric attaches provided Metric to the Logger allowing this metric to
+// record each invocation of Info and Error log lines, suppressed or not.
+func (l *Logger) Metric(m telemetry.Metric) telemetry.Logger {
+	return &Logger{logger: l.logger, ctx: l.ctx, args: l.args, metric: m, deduper: l.deduper}
+}
+
+// Clone the current Logger and return it. The clone has its own level and
+// tracks duplicates independently.
+func (l *Logger) Clone() telemetry.Logger {
+	return &Logger{
+		logger:  l.logger.Clone(),
+		ctx:     l.ctx,
+		args:    l.args,
+		metric:  l.metric,
+		deduper: newDeduper(l.deduper.options),
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/function"
+)
+
+// fakeClock controls time and the scheduled window ends.
+type fakeClock struct {
+	now     time.Time
+	pending []func()
+}
+
+func (c *fakeClock) option(o *options) {
+	o.now = func() time.Time { return c.now }
+	o.afterFunc = func(_ time.Duration, f func()) func() bool {
+		c.pending = append(c.pending, f)
+		return func() bool { return true }
+	}
+}
+
+// expire ends all scheduled windows.
+func (c *fakeClock) expire() {
+	pending := c.pending
+	c.pending = nil
+	for _, f := range pending {
+		f()
+	}
+}
+
+func TestDedup(t *testing.T) {
+	t0 := time.Unix(0, 0).UTC()
+	t1 := t0.Add(time.Second)
+
+	tests := []struct {
+		name     string
+		level    telemetry.Level
+		logfunc  func(telemetry.Logger, *fakeClock)
+		expected []string
+		metric   float64
+	}{
+		{"single", telemetry.LevelInfo, func(l telemetry.Logger, _ *fakeClock) { l.Info("text", "k", "v") },
+			[]string{`level=info msg="text" [ctx value k v]`}, 1},
+		{"repeated", telemetry.LevelInfo, func(l telemetry.Logger, c *fakeClock) {
+			l.Error("retry", errors.New("error"), "k", "v")
+			c.now = t1
+			l.Error("retry", errors.New("error"), "k", "v")
+			l.Error("retry", errors.New("error"), "k", "v")
+		}, []string{
+			`level=error msg="retry" err=error [ctx value k v]`,
+			fmt.Sprintf(`level=error msg="retry" err=error [ctx value k v repeated 3 first %v last %v]`, t0, t1),
+		}, 3},
+		{"distinct", telemetry.LevelDebug, func(l telemetry.Logger, _ *fakeClock) {
+			l.Debug("text", "k", "v")
+			l.Debug("text", "k", "w")
+			l.Info("text", "k", "v")
+			l.Error("text", errors.New("error1"))
+			l.Error("text", errors.New("error2"))
+			l.With("k", "v").Debug("text")
+		}, []string{
+			`level=debug msg="text" [ctx value k v]`,
+			`level=debug msg="text" [ctx value k w]`,
+			`level=info msg="text" [ctx value k v]`,
+			`level=error msg="text" err=error1 [ctx value]`,
+			`level=error msg="text" err=error2 [ctx value]`,
+			`level=debug msg="text" [ctx value k v]`,
+		}, 3},
+		{"disabled-level", telemetry.LevelError, func(l telemetry.Logger, _ *fakeClock) {
+			l.Info("text")
+			l.Info("text")
+		}, nil, 2},
+		{"new-window", telemetry.LevelInfo, func(l telemetry.Logger, c *fakeClock) {
+			l.Info("text")
+			c.expire()
+			l.Info("text")
+		}, []string{`level=info msg="text" [ctx value]`, `level=info msg="text" [ctx value]`}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				out   bytes.Buffer
+				clock = &fakeClock{now: t0}
+				inner = function.NewLogger(emitter(&out))
+			)
+			inner.SetLevel(tt.level)
+
+			metric := mockMetric{}
+			ctx := telemetry.KeyValuesToContext(context.Background(), "ctx", "value")
+			l := New(inner, clock.option).Context(ctx).Metric(&metric)
+
+			tt.logfunc(l, clock)
+			clock.expire()
+
+			if lines := lines(&out); strings.Join(lines, "\n") != strings.Join(tt.expected, "\n") {
+				t.Fatalf("lines=%q, want: %q", lines, tt.expected)
+			}
+			if metric.count != tt.metric {
+				t.Fatalf("metric.count=%v, want: %v", metric.count, tt.metric)
+			}
+		})
+	}
+}
+
+func TestFlush(t *testing.T) {
+	var out bytes.Buffer
+	l := New(function.NewLogger(emitter(&out)), WithWindow(time.Hour))
+
+	for i := 0; i < 3; i++ {
+		l.With("key", "value").Info("text")
+	}
+	if lines := lines(&out); len(lines) != 1 {
+		t.Fatalf("expected duplicates to be suppressed, got %q", lines)
+	}
+
+	Flush(l)
+	if lines := lines(&out); len(lines) != 2 || !strings.Contains(lines[1], "[key value repeated 3 first") {
+		t.Fatalf("expected summary line, got %q", lines)
+	}
+
+	Flush(l)
+	if lines := lines(&out); len(lines) != 2 {
+		t.Fatalf("expected no additional lines, got %q", lines)
+	}
+}
+
+func TestKeyValuesReused(t *testing.T) {
+	var (
+		out   bytes.Buffer
+		clock = &fakeClock{now: time.Unix(0, 0).UTC()}
+		l     = New(function.NewLogger(emitter(&out)), clock.option)
+	)
+
+	keyValues := []interface{}{"k", "v"}
+	l.Info("text", keyValues...)
+	l.Info("text", keyValues...)
+	// the caller reuses the array before the summary log line is written
+	keyValues[1] = "changed"
+	clock.expire()
+
+	if lines := lines(&out); len(lines) != 2 || !strings.HasPrefix(lines[1], `level=info msg="text" [k v repeated 2`) {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+}
+
+func TestID(t *testing.T) {
+	d := newDeduper(options{})
+	id := func(keyValues ...interface{}) uint64 {
+		return d.id(telemetry.LevelInfo, "text", nil, nil, keyValues)
+	}
+	if id("k", 1, "d", time.Second) != id("k", 1, "d", time.Second) {
+		t.Fatalf("expected identical key-values to have the same id")
+	}
+	for _, kvs := range [][]interface{}{{"k", "1"}, {"k", 1.0}, {"k1", ""}, {"k", 1, "", nil}} {
+		if id("k", 1) == id(kvs...) {
+			t.Fatalf("expected %v to have a different id than [k 1]", kvs)
+		}
+	}
+}
+
+func TestSharedLevel(t *testing.T) {
+	logger := New(function.NewLogger(nil))
+	derived := logger.With("key", "value").Context(context.Background())
+
+	logger.SetLevel(telemetry.LevelDebug)
+	if derived.Level() != telemetry.LevelDebug {
+		t.Fatalf("derived.Level()=%v, want: %v", derived.Level(), telemetry.LevelDebug)
+	}
+	clone := logger.Clone()
+	clone.SetLevel(telemetry.LevelError)
+	if logger.Level() != telemetry.LevelDebug {
+		t.Fatalf("logger.Level()=%v, want: %v", logger.Level(), telemetry.LevelDebug)
+	}
+}
+
+func lines(out *bytes.Buffer) []string {
+	if out.Len() == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+}
+
+func emitter(w io.Writer) function.Emit {
+	return func(level telemetry.Level, msg string, err error, values function.Values) {
+		_, _ = fmt.Fprintf(w, "level=%v msg=%q", level, msg)
+		if err != nil {
+			_, _ = fmt.Fprintf(w, " err=%v", err)
+		}
+
+		all := append(values.FromContext, values.FromLogger...)
+		all = append(all, values.FromMethod...)
+		_, _ = fmt.Fprintf(w, " %v\n", all)
+	}
+}
+
+type mockMetric struct {
+	telemetry.Metric
+	count float64
+}
+
+func (m *mockMetric) RecordContext(_ context.Context, value float64) { m.count += value }
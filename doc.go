@@ -16,7 +16,8 @@
 Package telemetry holds observability facades for our services and libraries.
 
 The provided interface here allows for instrumenting libraries and packages
-without any dependencies on Logging and Metric instrumentation implementations.
+without any dependencies on Logging, Metric and Tracing instrumentation
+implementations.
 This allows a consistent way of authoring Log lines and Metrics for the
 producers of these libraries and packages while providing consumers the ability
 to plug in the implementations of their choice.
@@ -64,6 +65,8 @@ Allow the Go Context object to be passed and have a registry for values of
 interest we want to pull from context. A good example of an item we want to
 automatically include in log lines is the `x-request-id` so we can tie log
 lines produced in the request path together.
+Values stored in Context by other libraries can be pulled into log lines by
+registering a ContextExtractor with RegisterContextExtractor.
 
   - Allow each component to have their own "scope".
 
@@ -0,0 +1,211 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// maxErrorDepth protects InspectError against cyclic or degenerate error
+// chains.
+const maxErrorDepth = 64
+
+// Error is an error carrying key-value pairs, allowing deep code to attach
+// details such as a user ID or shard to an error without logging it. Logging
+// implementations find the key-value pairs through InspectError, so they are
+// merged into the log line of the eventual Logger.Error call.
+type Error struct {
+	err       error
+	keyValues []interface{}
+}
+
+// Errorf returns an Error formatted like fmt.Errorf, including support for
+// wrapping errors with the %w verb.
+func Errorf(format string, args ...interface{}) *Error {
+	return &Error{err: fmt.Errorf(format, args...)}
+}
+
+// With returns a copy of the Error with the provided key-value pairs added.
+func (e *Error) With(keyValuePairs ...interface{}) *Error {
+	if len(keyValuePairs) == 0 {
+		return e
+	}
+	if len(keyValuePairs)%2 != 0 {
+		keyValuePairs = append(keyValuePairs, "(MISSING)")
+	}
+	return &Error{
+		err:       e.err,
+		keyValues: append(e.keyValues[:len(e.keyValues):len(e.keyValues)], keyValuePairs...),
+	}
+}
+
+// Context returns a copy of the Error with a snapshot of the key-value pairs
+// stored in the provided Context with KeyValuesToContext added. This preserves
+// request scoped details, e.g. the request ID, for errors logged outside the
+// request path. Key-value pairs returned by the registered ContextExtractors,
+// such as the trace and span IDs, are not added, as Loggers add them from
+// their own Context.
+func (e *Error) Context(ctx context.Context) *Error {
+	return e.With(storedKeyValues(ctx)...)
+}
+
+// Error implements error.
+func (e *Error) Error() string { return e.err.Error() }
+
+// Unwrap returns the error wrapped with the %w verb, if any. If several errors
+// are wrapped with multiple %w verbs, the formatted error is returned, which in
+// turn unwraps to all of them, so errors.Is and errors.As find each of them.
+func (e *Error) Unwrap() error {
+	if err := errors.Unwrap(e.err); err != nil {
+		return err
+	}
+	if _, ok := e.err.(interface{ Unwrap() []error }); ok {
+		return e.err
+	}
+	return nil
+}
+
+// KeyValues returns the key-value pairs carried by the Error.
+func (e *Error) KeyValues() []interface{} { return e.keyValues }
+
+// ErrorDetails holds the structured information extracted from an error by
+// InspectError. Logging implementations can use it to render errors passed to
+// Logger.Error as structured fields instead of a single message.
+type ErrorDetails struct {
+	// Message holds the message of the inspected error.
+	Message string
+	// Chain holds the messages of the errors found by following the Unwrap
+	// chain of the inspected error, outermost first.
+	Chain []string
+	// Errors holds the details of the errors wrapped by a multi-error found in
+	// the chain, i.e. an error implementing `Unwrap() []error` or
+	// `WrappedErrors() []error`.
+	Errors []ErrorDetails
+	// StackTrace holds the innermost stack trace found in the chain, provided
+	// by errors implementing a `StackTrace()` method, e.g. the errors of
+	// github.com/pkg/errors.
+	StackTrace string
+	// KeyValues holds the key-value pairs of the errors in the chain
+	// implementing `KeyValues() []interface{}`, outermost first.
+	KeyValues []interface{}
+}
+
+// InspectError extracts the Unwrap chain, multi-errors, stack trace and
+// key-value pairs of the provided error. It returns nil if err is nil.
+func InspectError(err error) *ErrorDetails {
+	if err == nil {
+		return nil
+	}
+	d := inspectError(err, 0)
+	return &d
+}
+
+func inspectError(err error, depth int) ErrorDetails {
+	if isNilPointer(err) {
+		// the methods of typed nil errors typically panic
+		return ErrorDetails{Message: "<nil>"}
+	}
+	d := ErrorDetails{Message: errorMessage(err)}
+	for ; err != nil && depth < maxErrorDepth; depth++ {
+		if kv, ok := err.(interface{ KeyValues() []interface{} }); ok {
+			keyValues := kv.KeyValues()
+			if len(keyValues)%2 != 0 {
+				keyValues = append(keyValues[:len(keyValues):len(keyValues)], "(MISSING)")
+			}
+			d.KeyValues = append(d.KeyValues, keyValues...)
+		}
+		if stack := stackTrace(err); stack != "" {
+			d.StackTrace = stack
+		}
+
+		if errs := multiErrors(err); errs != nil {
+			for _, e := range errs {
+				if e != nil {
+					d.Errors = append(d.Errors, inspectError(e, depth+1))
+				}
+			}
+			return d
+		}
+
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return d
+		}
+		if err = u.Unwrap(); isNilPointer(err) {
+			d.Chain = append(d.Chain, "<nil>")
+			return d
+		} else if err != nil {
+			// skip wrappers not changing the message, e.g. an Error wrapping
+			// multiple errors
+			last := d.Message
+			if len(d.Chain) > 0 {
+				last = d.Chain[len(d.Chain)-1]
+			}
+			if msg := errorMessage(err); msg != last {
+				d.Chain = append(d.Chain, msg)
+			}
+		}
+	}
+	return d
+}
+
+// errorMessage returns the message of err, recovering from a panicking Error
+// method the way fmt does.
+func errorMessage(err error) (msg string) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg = fmt.Sprintf("%%!v(PANIC=Error method: %v)", r)
+		}
+	}()
+	return err.Error()
+}
+
+// isNilPointer returns whether err holds a nil pointer.
+func isNilPointer(err error) bool {
+	v := reflect.ValueOf(err)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// multiErrors returns the errors wrapped by a multi-error.
+func multiErrors(err error) []error {
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		return e.Unwrap()
+	case interface{ WrappedErrors() []error }:
+		return e.WrappedErrors()
+	}
+	return nil
+}
+
+// stackTrace returns the formatted stack trace of errors having a
+// `StackTrace()` method. The method's result type differs between error
+// packages, so it is called through reflection and formatted with %+v.
+func stackTrace(err error) string {
+	m := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+		return ""
+	}
+	out := m.Call(nil)[0]
+	switch out.Kind() {
+	case reflect.Slice, reflect.Ptr, reflect.Interface, reflect.Map, reflect.Func:
+		if out.IsNil() {
+			return ""
+		}
+	}
+	return fmt.Sprintf("%+v", out.Interface())
+}
@@ -0,0 +1,163 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type stackError struct {
+	msg   string
+	stack []string
+}
+
+func (e stackError) Error() string        { return e.msg }
+func (e stackError) StackTrace() []string { return e.stack }
+
+type kvError struct {
+	err error
+	kvs []interface{}
+}
+
+func (e kvError) Error() string            { return "kv: " + e.err.Error() }
+func (e kvError) Unwrap() error            { return e.err }
+func (e kvError) KeyValues() []interface{} { return e.kvs }
+
+type ptrError struct{ msg string }
+
+func (e *ptrError) Error() string { return e.msg }
+
+type multiError []error
+
+func (e multiError) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		if err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+func (e multiError) Unwrap() []error { return e }
+
+type wrappedErrors []error
+
+func (e wrappedErrors) Error() string          { return "wrapped" }
+func (e wrappedErrors) WrappedErrors() []error { return e }
+
+func TestInspectError(t *testing.T) {
+	base := stackError{msg: "base", stack: []string{"main.go:1"}}
+
+	tests := []struct {
+		name string
+		err  error
+		want *ErrorDetails
+	}{
+		{"nil", nil, nil},
+		{"plain", errors.New("plain"), &ErrorDetails{Message: "plain"}},
+		{"stack", base, &ErrorDetails{Message: "base", StackTrace: "[main.go:1]"}},
+		{"nil-stack", stackError{msg: "base"}, &ErrorDetails{Message: "base"}},
+		{"chain", fmt.Errorf("outer: %w", kvError{err: fmt.Errorf("middle: %w", base), kvs: []interface{}{"key", "value", "odd"}}),
+			&ErrorDetails{
+				Message:    "outer: kv: middle: base",
+				Chain:      []string{"kv: middle: base", "middle: base", "base"},
+				StackTrace: "[main.go:1]",
+				KeyValues:  []interface{}{"key", "value", "odd", "(MISSING)"},
+			}},
+		{"multi", fmt.Errorf("failed: %w", multiError{errors.New("a"), nil, kvError{err: errors.New("b"), kvs: []interface{}{"k", 1}}}),
+			&ErrorDetails{
+				Message: "failed: a; kv: b",
+				Chain:   []string{"a; kv: b"},
+				Errors: []ErrorDetails{
+					{Message: "a"},
+					{Message: "kv: b", Chain: []string{"b"}, KeyValues: []interface{}{"k", 1}},
+				},
+			}},
+		{"typed-nil", (*ptrError)(nil), &ErrorDetails{Message: "<nil>"}},
+		{"wrapped-typed-nil", fmt.Errorf("outer: %w", (*ptrError)(nil)),
+			&ErrorDetails{Message: "outer: <nil>", Chain: []string{"<nil>"}}},
+		{"wrapped-errors", wrappedErrors{errors.New("a")},
+			&ErrorDetails{Message: "wrapped", Errors: []ErrorDetails{{Message: "a"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if have := InspectError(tt.err); !reflect.DeepEqual(have, tt.want) {
+				t.Fatalf("InspectError()=%+v, want: %+v", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestError(t *testing.T) {
+	cause := errors.New("connection refused")
+	ctx := KeyValuesToContext(context.Background(), "request_id", "abc")
+
+	base := Errorf("query shard %d: %w", 3, cause)
+	err := base.With("shard", 3).Context(ctx).With("user_id")
+
+	if err.Error() != "query shard 3: connection refused" {
+		t.Fatalf("Error()=%q", err.Error())
+	}
+	if !errors.Is(err, cause) || errors.Unwrap(err) != cause {
+		t.Fatalf("expected %v to wrap %v", err, cause)
+	}
+	want := []interface{}{"shard", 3, "request_id", "abc", "user_id", "(MISSING)"}
+	if !reflect.DeepEqual(err.KeyValues(), want) {
+		t.Fatalf("KeyValues()=%v, want: %v", err.KeyValues(), want)
+	}
+	if len(base.KeyValues()) != 0 || base.With() != base {
+		t.Fatalf("expected With to leave the original Error untouched")
+	}
+
+	details := InspectError(fmt.Errorf("handler: %w", err))
+	if !reflect.DeepEqual(details.KeyValues, want) {
+		t.Fatalf("InspectError().KeyValues=%v, want: %v", details.KeyValues, want)
+	}
+	if !reflect.DeepEqual(details.Chain, []string{err.Error(), cause.Error()}) {
+		t.Fatalf("InspectError().Chain=%v", details.Chain)
+	}
+}
+
+func TestErrorMultipleWrapped(t *testing.T) {
+	a, b := errors.New("a"), errors.New("b")
+	err := Errorf("x: %w %w", a, b)
+
+	if !errors.Is(err, a) || !errors.Is(err, b) {
+		t.Fatalf("expected %v to wrap %v and %v", err, a, b)
+	}
+	details := InspectError(err)
+	if len(details.Chain) != 0 || len(details.Errors) != 2 {
+		t.Fatalf("InspectError()=%+v, want: no chain and 2 errors", details)
+	}
+	if Errorf("plain").Unwrap() != nil {
+		t.Fatalf("expected Error without %%w verb not to unwrap")
+	}
+}
+
+func TestErrorContext(t *testing.T) {
+	ctx := KeyValuesToContext(context.Background(), "request_id", "abc")
+	ctx = ContextWithSpanContext(ctx, SpanContext{TraceID: TraceID{1}, SpanID: SpanID{2}})
+
+	want := []interface{}{"request_id", "abc"}
+	if have := Errorf("failed").Context(ctx).KeyValues(); !reflect.DeepEqual(have, want) {
+		t.Fatalf("KeyValues()=%v, want: %v", have, want)
+	}
+}
@@ -0,0 +1,323 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package function
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+// DropPolicy defines the behavior of the AsyncEmitter when its queue is full.
+type DropPolicy int
+
+// Available drop policies.
+const (
+	// Block blocks the caller until the queue has room for the log message.
+	Block DropPolicy = iota
+	// DropOldest drops the oldest queued log message to make room for the new
+	// one.
+	DropOldest
+	// DropNewest drops the new log message.
+	DropNewest
+)
+
+// dropPolicyToString maps each drop policy to its string representation.
+var dropPolicyToString = map[DropPolicy]string{
+	Block:      "block",
+	DropOldest: "drop-oldest",
+	DropNewest: "drop-newest",
+}
+
+// String returns the string representation of the drop policy.
+func (p DropPolicy) String() string { return dropPolicyToString[p] }
+
+// DefaultQueueSize is the default number of log messages the AsyncEmitter can
+// hold before applying its DropPolicy.
+const DefaultQueueSize = 1024
+
+// AsyncOption implements a functional option type for the AsyncEmitter.
+type AsyncOption func(*asyncOptions)
+
+type asyncOptions struct {
+	queueSize int
+	policy    DropPolicy
+	sink      telemetry.MetricSink
+}
+
+// WithQueueSize sets the maximum number of queued log messages.
+func WithQueueSize(size int) AsyncOption {
+	return func(o *asyncOptions) {
+		o.queueSize = size
+	}
+}
+
+// WithDropPolicy sets the behavior when the queue is full. By default the
+// caller is blocked.
+func WithDropPolicy(policy DropPolicy) AsyncOption {
+	return func(o *asyncOptions) {
+		o.policy = policy
+	}
+}
+
+// WithDropMetric records the number of dropped log messages in the
+// log_messages_dropped_total Sum of the provided MetricSink, labeled by level.
+func WithDropMetric(sink telemetry.MetricSink) AsyncOption {
+	return func(o *asyncOptions) {
+		o.sink = sink
+	}
+}
+
+// record holds a queued log message. Records with a done channel are flush
+// markers which are closed once all preceding log messages are emitted.
+type record struct {
+	Record
+	done chan struct{}
+}
+
+// AsyncEmitter wraps an Emit or EmitRecord function, moving the actual
+// emission of log messages to a dedicated goroutine so slow writers don't
+// stall the callers. Log messages are queued in a bounded queue and emitted in
+// order.
+type AsyncEmitter struct {
+	emit    EmitRecord
+	options asyncOptions
+	dropped uint64
+	metrics map[telemetry.Level]telemetry.Metric
+
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	queue    []record
+	// queued holds the number of log messages in the queue, excluding flush
+	// markers.
+	queued int
+	closed bool
+	// drained is set once the queue is drained after Close and the run
+	// goroutine stopped.
+	drained bool
+	stopped chan struct{}
+
+	// emitMu serializes the synchronous emission of log messages received
+	// once the queue is drained.
+	emitMu sync.Mutex
+}
+
+// NewAsyncEmitter returns an AsyncEmitter emitting log messages through the
+// provided Emit function on a dedicated goroutine. The AsyncEmitter's Emit
+// method is to be provided to NewLogger. As log messages are emitted after the
+// log call returns, the Emit function must not depend on the calling
+// goroutine. The Emit function is never called concurrently and log messages
+// are emitted in order, also after Close. Close must be called to stop the
+// goroutine.
+func NewAsyncEmitter(emit Emit, opts ...AsyncOption) *AsyncEmitter {
+	return NewAsyncRecordEmitter(func(r Record) { emit(r.Level, r.Message, r.Err, r.Values) }, opts...)
+}
+
+// NewAsyncRecordEmitter returns an AsyncEmitter emitting log messages through
+// the provided EmitRecord function on a dedicated goroutine. The
+// AsyncEmitter's EmitRecord method is to be provided to NewRecordLogger, so the
+// Record time is the one of the log call rather than the one of the emission.
+// As with NewAsyncEmitter, the EmitRecord function is never called
+// concurrently. Close must be called to stop the goroutine.
+func NewAsyncRecordEmitter(emit EmitRecord, opts ...AsyncOption) *AsyncEmitter {
+	o := asyncOptions{queueSize: DefaultQueueSize, policy: Block}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.queueSize < 1 {
+		o.queueSize = 1
+	}
+
+	a := &AsyncEmitter{
+		emit:    emit,
+		options: o,
+		queue:   make([]record, 0, o.queueSize),
+		stopped: make(chan struct{}),
+	}
+	a.notEmpty = sync.NewCond(&a.mu)
+	a.notFull = sync.NewCond(&a.mu)
+
+	if o.sink != nil {
+		level := o.sink.NewLabel("level")
+		dropped := o.sink.NewSum("log_messages_dropped_total",
+			"Total number of log messages dropped by the asynchronous emitter",
+			telemetry.WithLabels(level))
+		a.metrics = make(map[telemetry.Level]telemetry.Metric)
+		for _, l := range []telemetry.Level{telemetry.LevelError, telemetry.LevelInfo, telemetry.LevelDebug} {
+			a.metrics[l] = dropped.With(level.Insert(l.String()))
+		}
+	}
+
+	go a.run()
+	return a
+}
+
+// Emit queues the log message for emission, stamped with the current time.
+// Once the AsyncEmitter is closed and its queue drained, log messages are
+// emitted synchronously so none are lost during shutdown.
+func (a *AsyncEmitter) Emit(level telemetry.Level, msg string, err error, values Values) {
+	a.EmitRecord(Record{Time: time.Now(), Level: level, Message: msg, Err: err, Values: values})
+}
+
+// EmitRecord queues the Record for emission. Once the AsyncEmitter is closed
+// and its queue drained, log messages are emitted synchronously so none are
+// lost during shutdown.
+func (a *AsyncEmitter) EmitRecord(rec Record) {
+	// The key/value pairs of the logging method and the Context may be backed
+	// by arrays reused by the caller once the log call returns.
+	rec.Values.FromMethod = copyKeyValues(rec.Values.FromMethod)
+	rec.Values.FromContext = copyKeyValues(rec.Values.FromContext)
+	r := record{Record: rec}
+
+	// Log messages received after Close keep being queued until the run
+	// goroutine drained the queue, so they are emitted after the ones queued
+	// before.
+	a.mu.Lock()
+	for !a.drained && a.queued >= a.options.queueSize {
+		switch a.options.policy {
+		case DropNewest:
+			a.mu.Unlock()
+			a.drop(r)
+			return
+		case DropOldest:
+			a.drop(a.removeOldest())
+		default:
+			a.notFull.Wait()
+		}
+	}
+	if a.drained {
+		a.mu.Unlock()
+		a.emitMu.Lock()
+		defer a.emitMu.Unlock()
+		a.emit(rec)
+		return
+	}
+	a.queue = append(a.queue, r)
+	a.queued++
+	a.notEmpty.Signal()
+	a.mu.Unlock()
+}
+
+// copyKeyValues returns a copy of the provided key/value pairs.
+func copyKeyValues(keyValues []interface{}) []interface{} {
+	if len(keyValues) == 0 {
+		return keyValues
+	}
+	return append(make([]interface{}, 0, len(keyValues)), keyValues...)
+}
+
+// removeOldest removes and returns the oldest queued log message, skipping
+// flush markers. It must be called with the lock held on a non-empty queue.
+func (a *AsyncEmitter) removeOldest() record {
+	for i, r := range a.queue {
+		if r.done == nil {
+			a.queue = append(a.queue[:i], a.queue[i+1:]...)
+			a.queued--
+			return r
+		}
+	}
+	return record{}
+}
+
+// drop accounts for a dropped log message.
+func (a *AsyncEmitter) drop(r record) {
+	atomic.AddUint64(&a.dropped, 1)
+	if m, ok := a.metrics[r.Level]; ok {
+		m.Increment()
+	}
+}
+
+// Dropped returns the total number of dropped log messages.
+func (a *AsyncEmitter) Dropped() uint64 { return atomic.LoadUint64(&a.dropped) }
+
+// Flush blocks until all log messages queued before the call are emitted or
+// the provided Context is done, in which case the Context error is returned.
+func (a *AsyncEmitter) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return a.wait(ctx, a.stopped)
+	}
+	// flush markers don't count towards the queue size so Flush never blocks
+	// on a full queue.
+	a.queue = append(a.queue, record{done: done})
+	a.notEmpty.Signal()
+	a.mu.Unlock()
+
+	return a.wait(ctx, done)
+}
+
+// Close stops the AsyncEmitter and waits until all queued log messages are
+// emitted or the provided Context is done. Log messages received after Close
+// are queued until the queue is drained, even if the Context is done, and
+// emitted synchronously afterwards, preserving their order.
+func (a *AsyncEmitter) Close(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		a.notEmpty.Broadcast()
+		a.notFull.Broadcast()
+	}
+	a.mu.Unlock()
+
+	return a.wait(ctx, a.stopped)
+}
+
+func (a *AsyncEmitter) wait(ctx context.Context, done chan struct{}) error {
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run emits the queued log messages until the AsyncEmitter is closed and the
+// queue is drained.
+func (a *AsyncEmitter) run() {
+	defer close(a.stopped)
+	for {
+		a.mu.Lock()
+		for len(a.queue) == 0 && !a.closed {
+			a.notEmpty.Wait()
+		}
+		if len(a.queue) == 0 {
+			a.drained = true
+			a.notFull.Broadcast()
+			a.mu.Unlock()
+			return
+		}
+		r := a.queue[0]
+		a.queue[0] = record{}
+		a.queue = a.queue[1:]
+		if r.done == nil {
+			a.queued--
+			a.notFull.Signal()
+		}
+		a.mu.Unlock()
+
+		if r.done != nil {
+			close(r.done)
+			continue
+		}
+		a.emit(r.Record)
+	}
+}
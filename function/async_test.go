@@ -0,0 +1,236 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package function
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/metrictest"
+)
+
+// gatedEmitter records emitted messages. The first emitted message blocks
+// until the gate is opened, allowing tests to fill the queue.
+type gatedEmitter struct {
+	mu      sync.Mutex
+	msgs    []string
+	started chan struct{}
+	gate    chan struct{}
+	once    sync.Once
+}
+
+func newGatedEmitter() *gatedEmitter {
+	return &gatedEmitter{started: make(chan struct{}), gate: make(chan struct{})}
+}
+
+func (g *gatedEmitter) emit(_ telemetry.Level, msg string, _ error, _ Values) {
+	g.once.Do(func() {
+		close(g.started)
+		<-g.gate
+	})
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.msgs = append(g.msgs, msg)
+}
+
+func (g *gatedEmitter) messages() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.msgs...)
+}
+
+func TestAsyncEmitterDropPolicy(t *testing.T) {
+	tests := []struct {
+		policy   DropPolicy
+		expected []string
+		dropped  uint64
+	}{
+		{DropNewest, []string{"0", "1", "2"}, 2},
+		{DropOldest, []string{"0", "3", "4"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			var (
+				g    = newGatedEmitter()
+				sink = metrictest.NewSink(t)
+				a    = NewAsyncEmitter(g.emit, WithQueueSize(2), WithDropPolicy(tt.policy), WithDropMetric(sink))
+			)
+			a.Emit(telemetry.LevelInfo, "0", nil, Values{})
+			<-g.started
+			for _, msg := range []string{"1", "2", "3", "4"} {
+				a.Emit(telemetry.LevelInfo, msg, nil, Values{})
+			}
+			close(g.gate)
+
+			if err := a.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if msgs := g.messages(); !reflect.DeepEqual(msgs, tt.expected) {
+				t.Fatalf("messages=%v, want: %v", msgs, tt.expected)
+			}
+			if a.Dropped() != tt.dropped {
+				t.Fatalf("Dropped()=%d, want: %d", a.Dropped(), tt.dropped)
+			}
+			if !sink.ExpectSum("log_messages_dropped_total", metrictest.Labels{"level": "info"}).Equals(float64(tt.dropped)) {
+				t.Fatalf("log_messages_dropped_total=%v, want: %d",
+					sink.ExpectSum("log_messages_dropped_total", metrictest.Labels{"level": "info"}).Values(), tt.dropped)
+			}
+			if err := a.Close(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestAsyncEmitterBlock(t *testing.T) {
+	g := newGatedEmitter()
+	a := NewAsyncEmitter(g.emit, WithQueueSize(1))
+
+	a.Emit(telemetry.LevelInfo, "0", nil, Values{})
+	<-g.started
+	a.Emit(telemetry.LevelInfo, "1", nil, Values{})
+
+	emitted := make(chan struct{})
+	go func() {
+		a.Emit(telemetry.LevelInfo, "2", nil, Values{})
+		close(emitted)
+	}()
+	select {
+	case <-emitted:
+		t.Fatal("expected Emit to block on a full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Flush must time out while the emitter is stuck
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := a.Flush(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Flush()=%v, want: %v", err, context.DeadlineExceeded)
+	}
+
+	close(g.gate)
+	<-emitted
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := g.messages(); !reflect.DeepEqual(msgs, []string{"0", "1", "2"}) {
+		t.Fatalf("messages=%v, want: [0 1 2]", msgs)
+	}
+	if a.Dropped() != 0 {
+		t.Fatalf("Dropped()=%d, want: 0", a.Dropped())
+	}
+}
+
+func TestAsyncEmitterEmitAfterClose(t *testing.T) {
+	g := newGatedEmitter()
+	a := NewAsyncEmitter(g.emit)
+
+	a.Emit(telemetry.LevelInfo, "0", nil, Values{})
+	<-g.started
+	a.Emit(telemetry.LevelInfo, "1", nil, Values{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := a.Close(ctx); err != context.Canceled {
+		t.Fatalf("Close()=%v, want: %v", err, context.Canceled)
+	}
+	// the queue is still being drained, so log messages keep being queued
+	a.Emit(telemetry.LevelInfo, "2", nil, Values{})
+	a.Emit(telemetry.LevelInfo, "3", nil, Values{})
+
+	close(g.gate)
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	a.Emit(telemetry.LevelInfo, "4", nil, Values{})
+
+	if msgs := g.messages(); !reflect.DeepEqual(msgs, []string{"0", "1", "2", "3", "4"}) {
+		t.Fatalf("messages=%v, want: [0 1 2 3 4]", msgs)
+	}
+}
+
+func TestAsyncEmitterLogger(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		values []Values
+	)
+	a := NewAsyncEmitter(func(_ telemetry.Level, _ string, _ error, v Values) {
+		mu.Lock()
+		defer mu.Unlock()
+		values = append(values, v)
+	})
+	logger := NewLogger(a.Emit).With("key", "value")
+
+	for i := 0; i < 100; i++ {
+		logger.Info("text", "i", i)
+	}
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// after Close log lines are emitted synchronously
+	logger.Info("text", "i", 100)
+	if err := a.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(values) != 101 {
+		t.Fatalf("len(values)=%d, want: 101", len(values))
+	}
+	for i, v := range values {
+		if !reflect.DeepEqual(v.FromLogger, []interface{}{"key", "value"}) || v.FromMethod[1] != i {
+			t.Fatalf("unexpected values %v at %d", v, i)
+		}
+	}
+}
+
+func TestAsyncRecordEmitter(t *testing.T) {
+	var (
+		records []Record
+		now     = time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+		gate    = make(chan struct{})
+	)
+	a := NewAsyncRecordEmitter(func(r Record) {
+		<-gate
+		records = append(records, r)
+	})
+	logger := NewRecordLogger(a.EmitRecord, WithClock(func() time.Time { return now }))
+
+	keyValues := []interface{}{"key", "value"}
+	logger.Info("text", keyValues...)
+	// the caller reuses the array before the log message is emitted
+	keyValues[1] = "changed"
+	now = now.Add(time.Hour)
+	close(gate)
+
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("len(records)=%d, want: 1", len(records))
+	}
+	if want := []interface{}{"key", "value"}; !reflect.DeepEqual(records[0].Values.FromMethod, want) {
+		t.Fatalf("FromMethod=%v, want: %v", records[0].Values.FromMethod, want)
+	}
+	if want := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC); !records[0].Time.Equal(want) {
+		t.Fatalf("Time=%v, want: %v", records[0].Time, want)
+	}
+}
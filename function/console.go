@@ -0,0 +1,320 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package function
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+// ConsoleTimeFormat is the default time format of the ConsoleEmitter.
+const ConsoleTimeFormat = "15:04:05.000"
+
+// consoleMessageWidth is the width the message column is padded to when
+// key/value pairs follow it.
+const consoleMessageWidth = 40
+
+// ANSI escape sequences used by the ConsoleEmitter.
+const (
+	colorReset   = "\x1b[0m"
+	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
+	colorBlue    = "\x1b[34m"
+	colorCyan    = "\x1b[36m"
+	colorGray    = "\x1b[90m"
+	colorBoldRed = "\x1b[1;31m"
+)
+
+// WithColor forces ANSI colors on or off for the ConsoleEmitter. By default
+// colors are used when writing to a terminal and the NO_COLOR environment
+// variable is not set. Other Emitters ignore this option.
+func WithColor(enabled bool) EmitterOption {
+	return func(o *emitterOptions) {
+		o.color = &enabled
+	}
+}
+
+// Console writes human-friendly log messages meant for development. Its Emit
+// and EmitRecord methods can be used with NewLogger and NewRecordLogger
+// respectively:
+//
+//	logger := function.NewRecordLogger(function.ConsoleEmitter(os.Stderr).EmitRecord)
+//
+// Each log message is written as aligned time, level, scope and message
+// columns followed by the key/value pairs. Errors and multi-line values are
+// written on indented lines below the log message.
+type Console struct {
+	w       io.Writer
+	options emitterOptions
+	color   bool
+
+	mu sync.Mutex
+	// scopeWidth holds the width of the widest scope name seen so far, so
+	// the scope column stays aligned.
+	scopeWidth int
+}
+
+// ConsoleEmitter returns a Console writing to the provided io.Writer.
+func ConsoleEmitter(w io.Writer, opts ...EmitterOption) *Console {
+	o := newEmitterOptions(ConsoleTimeFormat, opts)
+	color := isTerminal(w) && os.Getenv("NO_COLOR") == ""
+	if o.color != nil {
+		color = *o.color
+	}
+	return &Console{w: w, options: o, color: color}
+}
+
+// isTerminal returns whether w writes to a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(interface{ Stat() (os.FileInfo, error) })
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Emit implements Emit.
+func (c *Console) Emit(level telemetry.Level, msg string, err error, values Values) {
+	name := ""
+	for i := 0; i+1 < len(values.FromLogger); i += 2 {
+		if values.FromLogger[i] == scopeKey {
+			name, _ = values.FromLogger[i+1].(string)
+		}
+	}
+	c.EmitRecord(Record{Time: c.options.clock(), Level: level, Message: msg, Err: err, Name: name, Values: values})
+}
+
+// EmitRecord implements EmitRecord.
+func (c *Console) EmitRecord(r Record) {
+	bp := bufferPool.Get().(*[]byte)
+
+	r.Name = escape(r.Name)
+	c.mu.Lock()
+	if len(r.Name) > c.scopeWidth {
+		c.scopeWidth = len(r.Name)
+	}
+	b := c.encode((*bp)[:0], r, c.scopeWidth)
+	_, _ = c.w.Write(b)
+	c.mu.Unlock()
+
+	if cap(b) <= maxPooledBuffer {
+		*bp = b
+		bufferPool.Put(bp)
+	}
+}
+
+func (c *Console) encode(b []byte, r Record, scopeWidth int) []byte {
+	if c.options.timeFormat != "" {
+		b = c.appendColored(b, colorGray, r.Time.Format(c.options.timeFormat))
+		b = append(b, ' ')
+	}
+	b = c.appendColored(b, levelColor(r.Level), fmt.Sprintf("%-5s", strings.ToUpper(r.Level.String())))
+	b = append(b, ' ')
+	if scopeWidth > 0 {
+		b = c.appendColored(b, colorCyan, fmt.Sprintf("%-*s", scopeWidth, r.Name))
+		b = append(b, ' ')
+	}
+	msg := escape(r.Message)
+	b = append(b, msg...)
+
+	var (
+		multiLine []string
+		first     = true
+	)
+	appendKeyValue := func(key string, value string) {
+		if strings.Contains(value, "\n") {
+			multiLine = append(multiLine, key, value)
+			return
+		}
+		if first {
+			if pad := consoleMessageWidth - len(msg); pad > 0 {
+				b = append(b, strings.Repeat(" ", pad)...)
+			}
+			first = false
+		}
+		b = append(b, ' ')
+		b = c.appendColored(b, colorBlue, escape(key)+"=")
+		b = append(b, consoleValue(value)...)
+	}
+
+	for n, keyValues := range [][]interface{}{r.Values.FromContext, r.Values.FromLogger, r.Values.FromMethod} {
+		for i := 0; i < len(keyValues); i += 2 {
+			key, ok := keyValues[i].(string)
+			if !ok {
+				key = fmt.Sprint(keyValues[i])
+			}
+			if n == 1 && key == scopeKey {
+				// the scope is written in its own column
+				continue
+			}
+			value := "(MISSING)"
+			if i+1 < len(keyValues) {
+				value = formatValue(keyValues[i+1], c.options.timeFormat)
+			}
+			appendKeyValue(key, value)
+		}
+	}
+	if caller := r.Values.Caller; caller != nil {
+		appendKeyValue(CallerKey, filepath.Base(caller.File)+":"+strconv.Itoa(caller.Line))
+	}
+	b = append(b, '\n')
+
+	for i := 0; i < len(multiLine); i += 2 {
+		b = append(b, "  "...)
+		b = c.appendColored(b, colorBlue, escape(multiLine[i])+":")
+		b = append(b, '\n')
+		b = appendIndented(b, "    ", multiLine[i+1])
+	}
+
+	if r.Err != nil {
+		b = c.appendError(b, r.Err, r.Values.FromError)
+	}
+	return b
+}
+
+// appendError writes the error, its Unwrap chain, wrapped errors and stack
+// trace on indented lines.
+func (c *Console) appendError(b []byte, err error, d *telemetry.ErrorDetails) []byte {
+	b = append(b, "  "...)
+	b = c.appendColored(b, colorRed, "error: ")
+	for i, line := range strings.Split(safeString(err, err.Error), "\n") {
+		if i > 0 {
+			b = append(b, "         "...)
+		}
+		b = c.appendColored(b, colorRed, escape(line))
+		b = append(b, '\n')
+	}
+	if d == nil {
+		return b
+	}
+	for _, cause := range d.Chain {
+		b = appendHanging(b, "    caused by: ", cause)
+	}
+	for _, e := range d.Errors {
+		b = appendHanging(b, "    - ", e.Message)
+	}
+	if d.StackTrace != "" {
+		b = appendIndented(b, "      ", strings.TrimPrefix(d.StackTrace, "\n"))
+	}
+	return b
+}
+
+// appendColored writes s wrapped in the provided color if colors are enabled.
+func (c *Console) appendColored(b []byte, color, s string) []byte {
+	if !c.color {
+		return append(b, s...)
+	}
+	b = append(b, color...)
+	b = append(b, s...)
+	return append(b, colorReset...)
+}
+
+// appendIndented writes every line of s prefixed with indent.
+func appendIndented(b []byte, indent, s string) []byte {
+	for _, line := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		b = append(b, indent...)
+		b = append(b, escape(line)...)
+		b = append(b, '\n')
+	}
+	return b
+}
+
+// appendHanging writes s prefixed with prefix, indenting the following lines
+// of s to align with the first one.
+func appendHanging(b []byte, prefix, s string) []byte {
+	indent := strings.Repeat(" ", len(prefix))
+	for i, line := range strings.Split(s, "\n") {
+		if i == 0 {
+			b = append(b, prefix...)
+		} else {
+			b = append(b, indent...)
+		}
+		b = append(b, escape(line)...)
+		b = append(b, '\n')
+	}
+	return b
+}
+
+// escape returns s with the non-printable runes other than tabs escaped the way strconv.Quote
+// escapes them, so control characters and ANSI escape sequences found in log
+// messages don't reach the terminal.
+func escape(s string) string {
+	var b []byte
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == '\t' || strconv.IsPrint(r) && (r != utf8.RuneError || size > 1) {
+			if b != nil {
+				b = append(b, s[i:i+size]...)
+			}
+			i += size
+			continue
+		}
+		if b == nil {
+			b = append(make([]byte, 0, len(s)+8), s[:i]...)
+		}
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, `\x`...)
+			b = append(b, hexDigits[s[i]>>4], hexDigits[s[i]&0xf])
+		} else {
+			q := strconv.QuoteRune(r)
+			b = append(b, q[1:len(q)-1]...)
+		}
+		i += size
+	}
+	if b == nil {
+		return s
+	}
+	return string(b)
+}
+
+// levelColor returns the color of the level column.
+func levelColor(level telemetry.Level) string {
+	switch level {
+	case telemetry.LevelError:
+		return colorBoldRed
+	case telemetry.LevelInfo:
+		return colorGreen
+	default:
+		return colorGray
+	}
+}
+
+// formatValue returns the string representation of a key/value pair value.
+func formatValue(v interface{}, timeFormat string) string {
+	if s, ok := stringValue(v, timeFormat); ok {
+		return s
+	}
+	if v == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%+v", v)
+}
+
+// consoleValue quotes the value if needed to keep it readable.
+func consoleValue(s string) string {
+	if needsQuoting(s) {
+		return strconv.Quote(s)
+	}
+	return s
+}
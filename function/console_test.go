@@ -0,0 +1,134 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package function
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+func TestConsoleEmitter(t *testing.T) {
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	pad := strings.Repeat(" ", consoleMessageWidth-len("text"))
+
+	tests := []struct {
+		name  string
+		logfn func(telemetry.Logger)
+		want  string
+	}{
+		{
+			"message",
+			func(l telemetry.Logger) { l.Info("text") },
+			"03:04:05.000 INFO  text\n",
+		},
+		{
+			"scope column",
+			func(l telemetry.Logger) {
+				l.With("scope", "server").Info("text", "key", "a value")
+				l.With("scope", "db").Debug("text")
+			},
+			"03:04:05.000 INFO  server text" + pad + ` key="a value"` + "\n" +
+				"03:04:05.000 DEBUG db     text\n",
+		},
+		{
+			"multi-line value",
+			func(l telemetry.Logger) { l.Info("text", "body", "line1\nline2", "n", 1) },
+			"03:04:05.000 INFO  text" + pad + " n=1\n" +
+				"  body:\n" +
+				"    line1\n" +
+				"    line2\n",
+		},
+		{
+			"typed nil",
+			func(l telemetry.Logger) { l.Info("text", "u", (*url.URL)(nil)) },
+			"03:04:05.000 INFO  text" + pad + " u=<nil>\n",
+		},
+		{
+			"typed nil error",
+			func(l telemetry.Logger) { l.Error("text", (*os.PathError)(nil)) },
+			"03:04:05.000 ERROR text\n  error: <nil>\n",
+		},
+		{
+			"escaping",
+			func(l telemetry.Logger) {
+				l.Error("te\x1b[31mxt\n", errors.New("bad\x07\xff\tinput"))
+			},
+			"03:04:05.000 ERROR te\\x1b[31mxt\\n\n" +
+				"  error: bad\\a\\xff\tinput\n",
+		},
+		{
+			"error",
+			func(l telemetry.Logger) {
+				l.Error("text", fmt.Errorf("wrapped: %w", errors.New("multi\nline")))
+			},
+			"03:04:05.000 ERROR text\n" +
+				"  error: wrapped: multi\n" +
+				"         line\n" +
+				"    caused by: multi\n" +
+				"               line\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			emitter := ConsoleEmitter(&out, WithEmitterClock(func() time.Time { return now }))
+			logger := NewLogger(emitter.Emit)
+			logger.SetLevel(telemetry.LevelDebug)
+
+			tt.logfn(logger)
+
+			if out.String() != tt.want {
+				t.Fatalf("out=%q, want: %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestConsoleColor(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger(ConsoleEmitter(&out, WithColor(true), WithTimeFormat("")).Emit)
+
+	logger.With("scope", "s").Error("text", errors.New("failed"))
+
+	want := colorBoldRed + "ERROR" + colorReset + " " + colorCyan + "s" + colorReset + " text\n" +
+		"  " + colorRed + "error: " + colorReset + colorRed + "failed" + colorReset + "\n"
+	if out.String() != want {
+		t.Fatalf("out=%q, want: %q", out.String(), want)
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "console")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if isTerminal(f) {
+		t.Fatalf("isTerminal(file)=true, want: false")
+	}
+	if isTerminal(&bytes.Buffer{}) {
+		t.Fatalf("isTerminal(buffer)=true, want: false")
+	}
+}
@@ -0,0 +1,485 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package function
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+// Keys of the fields written by the Emitter before the key/value pairs of
+// the log message. Key/value pairs using one of these keys are written with
+// the FieldKeyPrefix, so log lines never hold duplicate keys.
+const (
+	TimeKey       = "time"
+	LevelKey      = "level"
+	MessageKey    = "msg"
+	ErrorKey      = "error"
+	ErrorChainKey = "error_chain"
+	ErrorStackKey = "error_stack"
+	ErrorsKey     = "errors"
+	CallerKey     = "caller"
+
+	// FieldKeyPrefix is prepended to keys of key/value pairs clashing with
+	// the keys of the fields written by the Emitter.
+	FieldKeyPrefix = "fields."
+)
+
+// EmitterOption implements a functional option type for the Emitter.
+type EmitterOption func(*emitterOptions)
+
+type emitterOptions struct {
+	timeFormat string
+	clock      func() time.Time
+	color      *bool
+}
+
+// newEmitterOptions returns the emitterOptions with the provided default time
+// format and options applied.
+func newEmitterOptions(timeFormat string, opts []EmitterOption) emitterOptions {
+	o := emitterOptions{timeFormat: timeFormat, clock: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithTimeFormat sets the layout used to format the time of log messages and
+// time.Time values. By default time.RFC3339Nano is used, except for the
+// ConsoleEmitter which uses ConsoleTimeFormat. An empty layout omits the time
+// field.
+func WithTimeFormat(layout string) EmitterOption {
+	return func(o *emitterOptions) {
+		o.timeFormat = layout
+	}
+}
+
+// WithEmitterClock sets the function providing the time of log messages
+// written through Emit. EmitRecord uses the time found in the Record. By
+// default time.Now is used.
+func WithEmitterClock(clock func() time.Time) EmitterOption {
+	return func(o *emitterOptions) {
+		o.clock = clock
+	}
+}
+
+// encoding implements a line format for the Emitter.
+type encoding interface {
+	begin(b []byte) []byte
+	appendKey(b []byte, key string) []byte
+	appendString(b []byte, s string) []byte
+	appendStrings(b []byte, s []string) []byte
+	appendValue(b []byte, v interface{}, timeFormat string) []byte
+	end(b []byte) []byte
+}
+
+// Emitter writes log messages as single lines to an io.Writer. It provides
+// both an Emit and EmitRecord method to be used with NewLogger and
+// NewRecordLogger respectively:
+//
+//	logger := function.NewRecordLogger(function.JSONEmitter(os.Stderr).EmitRecord)
+//
+// Fields are written in a deterministic order: time, level, message, error
+// details (when Values.FromError is set), caller (when enabled with
+// WithCaller) and then the key/value pairs from the Context, the Logger and
+// the logging method, in that order.
+type Emitter struct {
+	w        io.Writer
+	mu       sync.Mutex
+	options  emitterOptions
+	encoding encoding
+}
+
+// JSONEmitter returns an Emitter writing log messages as JSON objects, one per
+// line.
+func JSONEmitter(w io.Writer, opts ...EmitterOption) *Emitter {
+	return newEmitter(w, jsonEncoding{}, opts)
+}
+
+// LogfmtEmitter returns an Emitter writing log messages in logfmt format.
+func LogfmtEmitter(w io.Writer, opts ...EmitterOption) *Emitter {
+	return newEmitter(w, logfmtEncoding{}, opts)
+}
+
+func newEmitter(w io.Writer, enc encoding, opts []EmitterOption) *Emitter {
+	return &Emitter{w: w, options: newEmitterOptions(time.RFC3339Nano, opts), encoding: enc}
+}
+
+// Emit implements Emit.
+func (e *Emitter) Emit(level telemetry.Level, msg string, err error, values Values) {
+	e.EmitRecord(Record{Time: e.options.clock(), Level: level, Message: msg, Err: err, Values: values})
+}
+
+// bufferPool holds the buffers used to encode log lines.
+var bufferPool = sync.Pool{New: func() interface{} {
+	b := make([]byte, 0, 1024)
+	return &b
+}}
+
+// maxPooledBuffer is the maximum capacity of buffers returned to the pool, so
+// a single huge log line doesn't pin memory.
+const maxPooledBuffer = 64 << 10
+
+// EmitRecord implements EmitRecord.
+func (e *Emitter) EmitRecord(r Record) {
+	bp := bufferPool.Get().(*[]byte)
+	b := e.encode((*bp)[:0], r)
+
+	e.mu.Lock()
+	_, _ = e.w.Write(b)
+	e.mu.Unlock()
+
+	if cap(b) <= maxPooledBuffer {
+		*bp = b
+		bufferPool.Put(bp)
+	}
+}
+
+func (e *Emitter) encode(b []byte, r Record) []byte {
+	enc := e.encoding
+	b = enc.begin(b)
+	if e.options.timeFormat != "" {
+		b = enc.appendKey(b, TimeKey)
+		b = enc.appendString(b, r.Time.Format(e.options.timeFormat))
+	}
+	b = enc.appendKey(b, LevelKey)
+	b = enc.appendString(b, r.Level.String())
+	b = enc.appendKey(b, MessageKey)
+	b = enc.appendString(b, r.Message)
+
+	if r.Err != nil {
+		b = enc.appendKey(b, ErrorKey)
+		b = enc.appendString(b, safeString(r.Err, r.Err.Error))
+	}
+	if d := r.Values.FromError; d != nil {
+		if len(d.Chain) > 0 {
+			b = enc.appendKey(b, ErrorChainKey)
+			b = enc.appendStrings(b, d.Chain)
+		}
+		if len(d.Errors) > 0 {
+			errs := make([]string, 0, len(d.Errors))
+			for _, e := range d.Errors {
+				errs = append(errs, e.Message)
+			}
+			b = enc.appendKey(b, ErrorsKey)
+			b = enc.appendStrings(b, errs)
+		}
+		if d.StackTrace != "" {
+			b = enc.appendKey(b, ErrorStackKey)
+			b = enc.appendString(b, d.StackTrace)
+		}
+	}
+	if c := r.Values.Caller; c != nil {
+		b = enc.appendKey(b, CallerKey)
+		b = enc.appendString(b, c.File+":"+strconv.Itoa(c.Line))
+	}
+
+	for _, keyValues := range [][]interface{}{r.Values.FromContext, r.Values.FromLogger, r.Values.FromMethod} {
+		for i := 0; i < len(keyValues); i += 2 {
+			key, ok := keyValues[i].(string)
+			if !ok {
+				key = fmt.Sprint(keyValues[i])
+			}
+			if reservedKey(key) {
+				key = FieldKeyPrefix + key
+			}
+			b = enc.appendKey(b, key)
+			if i+1 < len(keyValues) {
+				b = enc.appendValue(b, keyValues[i+1], e.options.timeFormat)
+			} else {
+				b = enc.appendString(b, "(MISSING)")
+			}
+		}
+	}
+	return enc.end(b)
+}
+
+// reservedKey returns whether key is used by a field written by the Emitter.
+func reservedKey(key string) bool {
+	switch key {
+	case TimeKey, LevelKey, MessageKey, ErrorKey, ErrorChainKey, ErrorStackKey, ErrorsKey, CallerKey:
+		return true
+	}
+	return false
+}
+
+// stringValue returns the string representation of values that are encoded
+// as strings and whether v is such a value.
+func stringValue(v interface{}, timeFormat string) (string, bool) {
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case error:
+		return safeString(v, t.Error), true
+	case time.Time:
+		if timeFormat == "" {
+			timeFormat = time.RFC3339Nano
+		}
+		return t.Format(timeFormat), true
+	case time.Duration:
+		return t.String(), true
+	case fmt.Stringer:
+		return safeString(v, t.String), true
+	}
+	return "", false
+}
+
+// safeString returns the result of the Error or String method of v. Like fmt,
+// it returns "<nil>" if the method panics because v is a nil pointer.
+func safeString(v interface{}, method func() string) (s string) {
+	defer func() {
+		if r := recover(); r != nil {
+			if isNilPointer(v) {
+				s = "<nil>"
+				return
+			}
+			s = fmt.Sprintf("%%!v(PANIC=%v)", r)
+		}
+	}()
+	return method()
+}
+
+// isNilPointer returns whether v holds a nil pointer.
+func isNilPointer(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
+
+// jsonEncoding encodes log lines as JSON objects.
+type jsonEncoding struct{}
+
+func (jsonEncoding) begin(b []byte) []byte { return append(b, '{') }
+
+func (jsonEncoding) end(b []byte) []byte { return append(b, '}', '\n') }
+
+func (j jsonEncoding) appendKey(b []byte, key string) []byte {
+	if b[len(b)-1] != '{' {
+		b = append(b, ',')
+	}
+	b = j.appendString(b, key)
+	return append(b, ':')
+}
+
+func (j jsonEncoding) appendStrings(b []byte, s []string) []byte {
+	b = append(b, '[')
+	for i, v := range s {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = j.appendString(b, v)
+	}
+	return append(b, ']')
+}
+
+func (j jsonEncoding) appendValue(b []byte, v interface{}, timeFormat string) []byte {
+	switch t := v.(type) {
+	case nil:
+		return append(b, "null"...)
+	case bool:
+		return strconv.AppendBool(b, t)
+	case int:
+		return strconv.AppendInt(b, int64(t), 10)
+	case int8:
+		return strconv.AppendInt(b, int64(t), 10)
+	case int16:
+		return strconv.AppendInt(b, int64(t), 10)
+	case int32:
+		return strconv.AppendInt(b, int64(t), 10)
+	case int64:
+		return strconv.AppendInt(b, t, 10)
+	case uint:
+		return strconv.AppendUint(b, uint64(t), 10)
+	case uint8:
+		return strconv.AppendUint(b, uint64(t), 10)
+	case uint16:
+		return strconv.AppendUint(b, uint64(t), 10)
+	case uint32:
+		return strconv.AppendUint(b, uint64(t), 10)
+	case uint64:
+		return strconv.AppendUint(b, t, 10)
+	case float32:
+		return j.appendFloat(b, float64(t), 32)
+	case float64:
+		return j.appendFloat(b, t, 64)
+	case time.Time:
+		// time.Time implements json.Marshaler, ignoring the time format.
+		s, _ := stringValue(t, timeFormat)
+		return j.appendString(b, s)
+	case json.Marshaler:
+		if isNilPointer(v) {
+			return append(b, "null"...)
+		}
+		// MarshalJSON output is neither validated nor compacted, so it could
+		// break the line or the JSON object. Invalid output falls back to a
+		// string value.
+		if data, err := t.MarshalJSON(); err == nil {
+			var buf bytes.Buffer
+			if err = json.Compact(&buf, data); err == nil {
+				return append(b, buf.Bytes()...)
+			}
+		}
+		if s, ok := stringValue(v, timeFormat); ok {
+			return j.appendString(b, s)
+		}
+		return j.appendString(b, fmt.Sprintf("%+v", v))
+	}
+	if s, ok := stringValue(v, timeFormat); ok {
+		return j.appendString(b, s)
+	}
+	if data, err := json.Marshal(v); err == nil {
+		return append(b, data...)
+	}
+	return j.appendString(b, fmt.Sprintf("%+v", v))
+}
+
+func (j jsonEncoding) appendFloat(b []byte, f float64, bitSize int) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		// JSON has no representation for these values.
+		return j.appendString(b, strconv.FormatFloat(f, 'g', -1, bitSize))
+	}
+	return strconv.AppendFloat(b, f, 'g', -1, bitSize)
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendString appends s as a JSON string. Invalid UTF-8 is replaced by the
+// Unicode replacement character.
+func (jsonEncoding) appendString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			b = append(b, s[start:i]...)
+			b = append(b, `\ufffd`...)
+		case r == '\u2028' || r == '\u2029':
+			// valid JSON, but not valid JavaScript
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+		default:
+			i += size
+			continue
+		}
+		i += size
+		start = i
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
+
+// logfmtEncoding encodes log lines as logfmt.
+type logfmtEncoding struct{}
+
+func (logfmtEncoding) begin(b []byte) []byte { return b }
+
+func (logfmtEncoding) end(b []byte) []byte { return append(b, '\n') }
+
+// appendKey appends the key, replacing characters not allowed in logfmt keys
+// by an underscore.
+func (logfmtEncoding) appendKey(b []byte, key string) []byte {
+	if len(b) > 0 {
+		b = append(b, ' ')
+	}
+	if key == "" {
+		key = "_"
+	}
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || r == 0x7f {
+			r = '_'
+		}
+		b = append(b, string(r)...)
+	}
+	return append(b, '=')
+}
+
+func (l logfmtEncoding) appendStrings(b []byte, s []string) []byte {
+	return l.appendString(b, strings.Join(s, "; "))
+}
+
+func (l logfmtEncoding) appendValue(b []byte, v interface{}, timeFormat string) []byte {
+	switch t := v.(type) {
+	case nil:
+		return append(b, "null"...)
+	case bool:
+		return strconv.AppendBool(b, t)
+	case int:
+		return strconv.AppendInt(b, int64(t), 10)
+	case int64:
+		return strconv.AppendInt(b, t, 10)
+	case uint64:
+		return strconv.AppendUint(b, t, 10)
+	case float64:
+		return strconv.AppendFloat(b, t, 'g', -1, 64)
+	}
+	if s, ok := stringValue(v, timeFormat); ok {
+		return l.appendString(b, s)
+	}
+	return l.appendString(b, fmt.Sprintf("%+v", v))
+}
+
+// appendString appends s, quoting it if needed.
+func (logfmtEncoding) appendString(b []byte, s string) []byte {
+	if needsQuoting(s) {
+		return strconv.AppendQuote(b, s)
+	}
+	return append(b, s...)
+}
+
+func needsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == utf8.RuneError || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
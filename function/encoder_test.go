@@ -0,0 +1,177 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package function
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+func TestEmitter(t *testing.T) {
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	ctx := telemetry.KeyValuesToContext(context.Background(), "ctx", "value")
+
+	tests := []struct {
+		name   string
+		opts   []EmitterOption
+		logfn  func(telemetry.Logger)
+		json   string
+		logfmt string
+	}{
+		{
+			"info",
+			nil,
+			func(l telemetry.Logger) { l.Info("text") },
+			`{"time":"2023-01-02T03:04:05Z","level":"info","msg":"text"}` + "\n",
+			`time=2023-01-02T03:04:05Z level=info msg=text` + "\n",
+		},
+		{
+			"key order",
+			nil,
+			func(l telemetry.Logger) { l.Context(ctx).With("logger", 1).Info("text", "method", true) },
+			`{"time":"2023-01-02T03:04:05Z","level":"info","msg":"text","ctx":"value","logger":1,"method":true}` + "\n",
+			`time=2023-01-02T03:04:05Z level=info msg=text ctx=value logger=1 method=true` + "\n",
+		},
+		{
+			"escaping",
+			[]EmitterOption{WithTimeFormat("")},
+			func(l telemetry.Logger) { l.Info("a \"quoted\"\nline", "k ey=", "tab\there", "ctl", "\x01\u2028\xff") },
+			`{"level":"info","msg":"a \"quoted\"\nline","k ey=":"tab\there","ctl":"\u0001\u2028\ufffd"}` + "\n",
+			`level=info msg="a \"quoted\"\nline" k_ey_="tab\there" ctl="\x01\u2028\xff"` + "\n",
+		},
+		{
+			"values",
+			[]EmitterOption{WithTimeFormat(time.Kitchen)},
+			func(l telemetry.Logger) {
+				l.Info("text", "dur", time.Second, "time", now, "nil", nil, "float", 1.5, "nan", math.NaN(),
+					"map", map[string]int{"a": 1}, "empty", "", "missing")
+			},
+			`{"time":"3:04AM","level":"info","msg":"text","dur":"1s","fields.time":"3:04AM","nil":null,"float":1.5,"nan":"NaN","map":{"a":1},"empty":"","missing":"(MISSING)"}` + "\n",
+			`time=3:04AM level=info msg=text dur=1s fields.time=3:04AM nil=null float=1.5 nan=NaN map=map[a:1] empty="" missing=(MISSING)` + "\n",
+		},
+		{
+			"reserved keys",
+			[]EmitterOption{WithTimeFormat("")},
+			func(l telemetry.Logger) {
+				l.With("level", "debug").Error("text", errors.New("error"), "msg", "other", "error", "none", "caller", 1)
+			},
+			`{"level":"error","msg":"text","error":"error","fields.level":"debug","fields.msg":"other","fields.error":"none","fields.caller":1}` + "\n",
+			`level=error msg=text error=error fields.level=debug fields.msg=other fields.error=none fields.caller=1` + "\n",
+		},
+		{
+			"json marshaler",
+			[]EmitterOption{WithTimeFormat("")},
+			func(l telemetry.Logger) {
+				l.Info("text", "indented", rawJSON("{\n  \"a\": 1\n}"), "invalid", rawJSON(`{"a":`))
+			},
+			`{"level":"info","msg":"text","indented":{"a":1},"invalid":"{\"a\":"}` + "\n",
+			`level=info msg=text indented="{\n  \"a\": 1\n}" invalid="{\"a\":"` + "\n",
+		},
+		{
+			"typed nil",
+			[]EmitterOption{WithTimeFormat("")},
+			func(l telemetry.Logger) { l.Info("text", "u", (*url.URL)(nil), "e", (*os.PathError)(nil)) },
+			`{"level":"info","msg":"text","u":"<nil>","e":"<nil>"}` + "\n",
+			`level=info msg=text u=<nil> e=<nil>` + "\n",
+		},
+		{
+			"typed nil error",
+			[]EmitterOption{WithTimeFormat("")},
+			func(l telemetry.Logger) { l.Error("text", (*os.PathError)(nil)) },
+			`{"level":"error","msg":"text","error":"<nil>"}` + "\n",
+			`level=error msg=text error=<nil>` + "\n",
+		},
+		{
+			"error",
+			[]EmitterOption{WithTimeFormat("")},
+			func(l telemetry.Logger) {
+				l.Error("text", fmt.Errorf("wrapped: %w", telemetry.Errorf("inner").With("id", 1)))
+			},
+			`{"level":"error","msg":"text","error":"wrapped: inner","error_chain":["inner"],"id":1}` + "\n",
+			`level=error msg=text error="wrapped: inner" error_chain=inner id=1` + "\n",
+		},
+		{
+			"multi error",
+			[]EmitterOption{WithTimeFormat("")},
+			func(l telemetry.Logger) { l.Error("text", multiError{errors.New("a"), errors.New("b")}) },
+			`{"level":"error","msg":"text","error":"a; b","errors":["a","b"]}` + "\n",
+			`level=error msg=text error="a; b" errors="a; b"` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]EmitterOption{WithEmitterClock(func() time.Time { return now })}, tt.opts...)
+
+			var out bytes.Buffer
+			tt.logfn(NewLogger(JSONEmitter(&out, opts...).Emit))
+			if out.String() != tt.json {
+				t.Fatalf("json=%s, want: %s", out.String(), tt.json)
+			}
+			if !json.Valid(out.Bytes()) {
+				t.Fatalf("json=%s is not valid", out.String())
+			}
+
+			out.Reset()
+			tt.logfn(NewLogger(LogfmtEmitter(&out, opts...).Emit))
+			if out.String() != tt.logfmt {
+				t.Fatalf("logfmt=%s, want: %s", out.String(), tt.logfmt)
+			}
+		})
+	}
+}
+
+func TestEmitterRecord(t *testing.T) {
+	var (
+		out bytes.Buffer
+		now = time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	)
+	logger := NewRecordLogger(JSONEmitter(&out, WithTimeFormat(time.RFC3339)).EmitRecord,
+		WithClock(func() time.Time { return now }), WithCaller())
+
+	logger.Info("text")
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if line[TimeKey] != "2023-01-02T03:04:05Z" {
+		t.Fatalf("time=%v, want: %v", line[TimeKey], "2023-01-02T03:04:05Z")
+	}
+	if _, ok := line[CallerKey]; !ok {
+		t.Fatalf("caller missing in %s", out.String())
+	}
+}
+
+// rawJSON is a json.Marshaler returning its value verbatim.
+type rawJSON string
+
+func (r rawJSON) MarshalJSON() ([]byte, error) { return []byte(r), nil }
+func (r rawJSON) String() string               { return string(r) }
+
+type multiError []error
+
+func (m multiError) Error() string   { return fmt.Sprintf("%v; %v", m[0], m[1]) }
+func (m multiError) Unwrap() []error { return m }
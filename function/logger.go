@@ -18,7 +18,9 @@ package function
 
 import (
 	"context"
+	"runtime"
 	"sync/atomic"
+	"time"
 
 	"github.com/tetratelabs/telemetry"
 )
@@ -36,11 +38,17 @@ type (
 	// Values contains all the key/value pairs to be included when emitting logs.
 	Values struct {
 		// FromContext has all the key/value pairs that have been added to the Logger Context
+		// as well as the ones returned by the registered telemetry.ContextExtractors
 		FromContext []interface{}
 		// FromLogger has all the key/value pairs that have been added to the Logger object itself
 		FromLogger []interface{}
-		// FromMethod has the key/value pairs that were passed to the logging method.
+		// FromMethod has the key/value pairs that were passed to the logging method,
+		// followed by the ones carried by the error, if any
 		FromMethod []interface{}
+		// FromError has the structured details of the error passed to the logging method, if any.
+		FromError *telemetry.ErrorDetails
+		// Caller has the call site of the logging method if enabled with WithCaller.
+		Caller *Caller
 	}
 
 	// Logger is an implementation of the telemetry.Logger that allows configuring named
@@ -56,21 +64,75 @@ type (
 		// level holds the configured log level.
 		level *int32
 		// emitFunc is the function that will be used to actually emit the logs
-		emitFunc Emit
+		emitFunc EmitRecord
+		// options holds the configuration provided to NewLogger.
+		options options
+	}
+
+	// Caller holds the call site of a log message.
+	Caller struct {
+		// File holds the full path of the source file.
+		File string
+		// Line holds the line number in the source file.
+		Line int
+		// Function holds the package path qualified function name.
+		Function string
+	}
+
+	// EmitRecord is a function that will be used to produce log messages by the function Logger,
+	// receiving the complete Record of the log message. It is an extended alternative to Emit with
+	// the same guarantees: it is only called when the log actually needs to be emitted.
+	EmitRecord func(r Record)
+
+	// Record holds all the information of a log message to be emitted.
+	Record struct {
+		// Time of the log message as provided by the Logger clock.
+		Time time.Time
+		// Level of the log message.
+		Level telemetry.Level
+		// Message of the log message.
+		Message string
+		// Err holds the error passed to the Error method, if any.
+		Err error
+		// Name holds the name of the Logger, which is the scope name added with
+		// the "scope" key, if any.
+		Name string
+		// Sequence holds the sequence number of the log message. Sequence numbers
+		// are shared by all Loggers derived from the same NewLogger call and start at 1.
+		Sequence uint64
+		// Values holds the key/value pairs to be included in the log message.
+		Values Values
 	}
 )
 
-// compile time check for compatibility with the telemetry.Logger interface.
-var _ telemetry.Logger = (*Logger)(nil)
+// compile time check for compatibility with the telemetry.Logger and
+// telemetry.CallerSkipper interfaces.
+var (
+	_ telemetry.Logger        = (*Logger)(nil)
+	_ telemetry.CallerSkipper = (*Logger)(nil)
+)
 
 // NewLogger creates a new function Logger that uses the given Emit function to write log messages.
-// Loggers are configured at telemetry.LevelInfo level by default.
-func NewLogger(emitFunc Emit) telemetry.Logger {
-	lvl := int32(telemetry.LevelInfo)
+// Loggers are configured at telemetry.LevelInfo level by default, which can be changed with WithLevel.
+func NewLogger(emitFunc Emit, opts ...Option) telemetry.Logger {
+	var emitRecord EmitRecord
+	if emitFunc != nil {
+		emitRecord = func(r Record) { emitFunc(r.Level, r.Message, r.Err, r.Values) }
+	}
+	return NewRecordLogger(emitRecord, opts...)
+}
+
+// NewRecordLogger creates a new function Logger that uses the given EmitRecord function to write
+// log messages.
+// Loggers are configured at telemetry.LevelInfo level by default, which can be changed with WithLevel.
+func NewRecordLogger(emitFunc EmitRecord, opts ...Option) telemetry.Logger {
+	o := newOptions(opts)
+	lvl := int32(normalizeLevel(o.level))
 	return &Logger{
 		ctx:      context.Background(),
 		level:    &lvl,
 		emitFunc: emitFunc,
+		options:  o,
 	}
 }
 
@@ -85,10 +147,8 @@ func (l *Logger) Debug(msg string, keyValues ...interface{}) {
 // Info emits a log message at info level with the given key value pairs.
 func (l *Logger) Info(msg string, keyValues ...interface{}) {
 	// even if we don't output the log line due to the level configuration,
-	// we always emit the Metric if it is set.
-	if l.metric != nil {
-		l.metric.RecordContext(l.ctx, 1)
-	}
+	// we emit the Metric if it is set, unless configured otherwise.
+	l.record(telemetry.LevelInfo)
 	if !l.enabled(telemetry.LevelInfo) {
 		return
 	}
@@ -100,10 +160,8 @@ func (l *Logger) Info(msg string, keyValues ...interface{}) {
 // string.
 func (l *Logger) Error(msg string, err error, keyValues ...interface{}) {
 	// even if we don't output the log line due to the level configuration,
-	// we always emit the Metric if it is set.
-	if l.metric != nil {
-		l.metric.RecordContext(l.ctx, 1)
-	}
+	// we emit the Metric if it is set, unless configured otherwise.
+	l.record(telemetry.LevelError)
 
 	if !l.enabled(telemetry.LevelError) {
 		return
@@ -117,11 +175,60 @@ func (l *Logger) emit(level telemetry.Level, msg string, err error, keyValues []
 	// Note that here we don't ensure an even number of arguments in the keyValues slice.
 	// We let that to the emit function implementation with the idea of being able to accommodate
 	// unstructured loggers that don't use arguments as key/value pairs.
-	l.emitFunc(level, msg, err, Values{
-		FromContext: telemetry.KeyValuesFromContext(l.ctx),
-		FromLogger:  l.args,
-		FromMethod:  keyValues,
-	})
+	details := telemetry.InspectError(err)
+	if details != nil && len(details.KeyValues) > 0 {
+		// Key-value pairs carried by the error are merged into the ones of the
+		// logging method, so they end up in the log line.
+		if len(keyValues)%2 != 0 {
+			keyValues = append(keyValues, "(MISSING)")
+		}
+		keyValues = append(keyValues[:len(keyValues):len(keyValues)], details.KeyValues...)
+	}
+	var caller *Caller
+	if l.options.caller {
+		caller = callerAt(emitDepth + l.options.callerSkip)
+	}
+	r := Record{
+		Time:     l.options.clock(),
+		Level:    level,
+		Message:  msg,
+		Err:      err,
+		Name:     l.name(),
+		Sequence: atomic.AddUint64(l.options.sequence, 1),
+		Values: Values{
+			FromContext: telemetry.KeyValuesFromContext(l.ctx),
+			FromLogger:  l.args,
+			FromMethod:  keyValues,
+			FromError:   details,
+			Caller:      caller,
+		},
+	}
+	for _, hook := range l.options.hooks {
+		hook(&r)
+	}
+	l.emitFunc(r)
+}
+
+// record records the Metric, if set, for a log message at the given level
+// according to the configured MetricPolicy.
+func (l *Logger) record(level telemetry.Level) {
+	if l.metric == nil {
+		return
+	}
+	if l.options.metricPolicy == MetricWhenEnabled && !l.enabled(level) {
+		return
+	}
+	l.metric.RecordContext(l.ctx, 1)
+}
+
+// name returns the last value added with the scope key.
+func (l *Logger) name() (name string) {
+	for i := 0; i+1 < len(l.args); i += 2 {
+		if l.args[i] == scopeKey {
+			name, _ = l.args[i+1].(string)
+		}
+	}
+	return
 }
 
 // Level returns the logging level configured for this Logger.
@@ -129,18 +236,21 @@ func (l *Logger) Level() telemetry.Level { return telemetry.Level(atomic.LoadInt
 
 // SetLevel configures the logging level for the Logger.
 func (l *Logger) SetLevel(level telemetry.Level) {
+	atomic.StoreInt32(l.level, int32(normalizeLevel(level)))
+}
+
+// normalizeLevel maps the given level to the closest supported level.
+func normalizeLevel(level telemetry.Level) telemetry.Level {
 	switch {
 	case level < telemetry.LevelError:
-		level = telemetry.LevelNone
+		return telemetry.LevelNone
 	case level < telemetry.LevelInfo:
-		level = telemetry.LevelError
+		return telemetry.LevelError
 	case level < telemetry.LevelDebug:
-		level = telemetry.LevelInfo
+		return telemetry.LevelInfo
 	default:
-		level = telemetry.LevelDebug
+		return telemetry.LevelDebug
 	}
-
-	atomic.StoreInt32(l.level, int32(level))
 }
 
 // enabled checks if the current Logger should emit log messages for the given
@@ -158,7 +268,7 @@ func (l *Logger) With(keyValues ...interface{}) telemetry.Logger {
 
 	// We don't call Clone() here as we don't want to deference the level pointer;
 	// we just want to add the given args.
-	newLogger := newLoggerWithValues(l.ctx, l.metric, l.level, l.emitFunc, l.args)
+	newLogger := newLoggerWithValues(l.ctx, l.metric, l.level, l.emitFunc, l.args, l.options)
 
 	for i := 0; i < len(keyValues); i += 2 {
 		if k, ok := keyValues[i].(string); ok {
@@ -174,7 +284,7 @@ func (l *Logger) With(keyValues ...interface{}) telemetry.Logger {
 func (l *Logger) Context(ctx context.Context) telemetry.Logger {
 	// We don't call Clone() here as we don't want to deference the level pointer;
 	// we just want to set the context.
-	return newLoggerWithValues(ctx, l.metric, l.level, l.emitFunc, l.args)
+	return newLoggerWithValues(ctx, l.metric, l.level, l.emitFunc, l.args, l.options)
 }
 
 // Metric attaches provided Metric to the Logger allowing this metric to
@@ -183,7 +293,7 @@ func (l *Logger) Context(ctx context.Context) telemetry.Logger {
 func (l *Logger) Metric(m telemetry.Metric) telemetry.Logger {
 	// We don't call Clone() here as we don't want to deference the level pointer;
 	// we just want to set the metric.
-	return newLoggerWithValues(l.ctx, m, l.level, l.emitFunc, l.args)
+	return newLoggerWithValues(l.ctx, m, l.level, l.emitFunc, l.args, l.options)
 }
 
 // Clone the current Logger and return it
@@ -191,18 +301,44 @@ func (l *Logger) Clone() telemetry.Logger {
 	// When cloning the logger, we don't want both logger to share a level.
 	// We need to dereference the pointer and set the level properly.
 	lvl := *l.level
-	return newLoggerWithValues(l.ctx, l.metric, &lvl, l.emitFunc, l.args)
+	return newLoggerWithValues(l.ctx, l.metric, &lvl, l.emitFunc, l.args, l.options)
+}
+
+// AddCallerSkip returns a Logger sharing the level of this Logger which skips
+// the provided number of additional stack frames when capturing the call site.
+func (l *Logger) AddCallerSkip(skip int) telemetry.Logger {
+	o := l.options
+	o.callerSkip += skip
+	return newLoggerWithValues(l.ctx, l.metric, l.level, l.emitFunc, l.args, o)
 }
 
 // newLoggerWithValues creates a new instance of a logger with the given data.
-func newLoggerWithValues(ctx context.Context, m telemetry.Metric, l *int32, f Emit, args []interface{}) *Logger {
+func newLoggerWithValues(ctx context.Context, m telemetry.Metric, l *int32, f EmitRecord, args []interface{}, o options) *Logger {
 	newLogger := &Logger{
 		args:     make([]interface{}, len(args)),
 		ctx:      ctx,
 		metric:   m,
 		level:    l,
 		emitFunc: f,
+		options:  o,
 	}
 	copy(newLogger.args, args)
 	return newLogger
 }
+
+// emitDepth is the number of stack frames between the call site of a logging
+// method and the capture of the call site in emit.
+const emitDepth = 3
+
+// callerAt returns the call site found skip frames up the stack of its caller.
+func callerAt(skip int) *Caller {
+	pc, file, line, ok := runtime.Caller(skip)
+	if !ok {
+		return nil
+	}
+	c := &Caller{File: file, Line: line}
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		c.Function = fn.Name()
+	}
+	return c
+}
@@ -20,6 +20,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/tetratelabs/telemetry"
@@ -150,6 +152,100 @@ func TestClone(t *testing.T) {
 	}
 }
 
+func TestErrorDetails(t *testing.T) {
+	var details []*telemetry.ErrorDetails
+	logger := NewLogger(func(_ telemetry.Level, _ string, _ error, values Values) {
+		details = append(details, values.FromError)
+	})
+
+	logger.Info("text")
+	logger.Error("text", fmt.Errorf("outer: %w", errors.New("inner")))
+
+	if len(details) != 2 || details[0] != nil {
+		t.Fatalf("unexpected error details %v", details)
+	}
+	if details[1].Message != "outer: inner" || len(details[1].Chain) != 1 || details[1].Chain[0] != "inner" {
+		t.Fatalf("unexpected error details %+v", details[1])
+	}
+}
+
+func TestErrorKeyValues(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger(func(_ telemetry.Level, msg string, err error, values Values) {
+		_, _ = fmt.Fprintf(&out, "msg=%q err=%v %v", msg, err, values.FromMethod)
+	})
+
+	err := telemetry.Errorf("lookup failed").With("user_id", 42)
+	logger.Error("request failed", fmt.Errorf("handler: %w", err), "odd")
+
+	expected := `msg="request failed" err=handler: lookup failed [odd (MISSING) user_id 42]`
+	if out.String() != expected {
+		t.Fatalf("out=%q, want: %q", out.String(), expected)
+	}
+}
+
+type ptrError struct{ msg string }
+
+func (e *ptrError) Error() string { return e.msg }
+
+func TestErrorTypedNil(t *testing.T) {
+	var details *telemetry.ErrorDetails
+	logger := NewLogger(func(_ telemetry.Level, _ string, _ error, values Values) {
+		details = values.FromError
+	})
+
+	logger.Error("text", (*ptrError)(nil))
+
+	if details == nil || details.Message != "<nil>" {
+		t.Fatalf("unexpected error details %+v", details)
+	}
+}
+
+func TestCaller(t *testing.T) {
+	var caller *Caller
+	emit := func(_ telemetry.Level, _ string, _ error, values Values) { caller = values.Caller }
+
+	NewLogger(emit).Info("text")
+	if caller != nil {
+		t.Fatalf("expected no caller by default, got %+v", caller)
+	}
+
+	logger := NewLogger(emit, WithCaller())
+	logger.SetLevel(telemetry.LevelDebug)
+	wrapped := telemetry.AddCallerSkip(logger, 1)
+
+	tests := []struct {
+		name    string
+		logfunc func() int
+	}{
+		{"debug", func() int { logger.Debug("text"); return line() }},
+		{"info", func() int { logger.With("key", "value").Info("text"); return line() }},
+		{"error", func() int { logger.Context(context.Background()).Error("text", nil); return line() }},
+		{"skipped", func() int { logWrapped(wrapped); return line() }},
+		{"skipped-derived", func() int { logWrapped(wrapped.With("key", "value").Clone()); return line() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller = nil
+			want := tt.logfunc()
+			if caller == nil || caller.Line != want || !strings.HasSuffix(caller.File, "function/logger_test.go") ||
+				!strings.HasPrefix(caller.Function, "github.com/tetratelabs/telemetry/function.TestCaller") {
+				t.Fatalf("caller=%+v, want line: %d", caller, want)
+			}
+		})
+	}
+}
+
+// logWrapped mimics a Logger wrapper adding a stack frame.
+func logWrapped(l telemetry.Logger) { l.Info("text") }
+
+// line returns the line number of its caller.
+func line() int {
+	_, _, l, _ := runtime.Caller(1)
+	return l
+}
+
 type mockMetric struct {
 	telemetry.Metric
 	count float64
@@ -0,0 +1,119 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package function
+
+import (
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+// scopeKey is the key holding the Logger name, matching scope.Key. The scope
+// package is not imported as its tests depend on this package.
+const scopeKey = "scope"
+
+// MetricPolicy defines when the Metric attached to a Logger is recorded.
+type MetricPolicy int
+
+// Available metric policies.
+const (
+	// MetricAlways records the Metric on each Info and Error call, even if the
+	// log message is not emitted due to the configured level. This is the
+	// behavior described by the telemetry.Logger interface.
+	MetricAlways MetricPolicy = iota
+	// MetricWhenEnabled only records the Metric if the configured level
+	// enables the log message.
+	MetricWhenEnabled
+)
+
+// Hook is called with the Record of each log message before it is emitted. It
+// runs on the goroutine of the logging method call and can modify the Record,
+// e.g. to add key/value pairs.
+type Hook func(r *Record)
+
+// Option implements a functional option type for the function Logger.
+type Option func(*options)
+
+type options struct {
+	// level holds the initial log level.
+	level telemetry.Level
+	// clock provides the time of log messages.
+	clock func() time.Time
+	// caller enables capturing the call site of log messages.
+	caller bool
+	// callerSkip holds the number of additional stack frames to skip when
+	// capturing the call site.
+	callerSkip int
+	// hooks holds the Hooks called before emitting a log message.
+	hooks []Hook
+	// metricPolicy defines when the attached Metric is recorded.
+	metricPolicy MetricPolicy
+	// sequence holds the last sequence number shared by all Loggers derived
+	// from the same root Logger.
+	sequence *uint64
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		level:    telemetry.LevelInfo,
+		clock:    time.Now,
+		sequence: new(uint64),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithLevel sets the initial log level of the Logger.
+func WithLevel(level telemetry.Level) Option {
+	return func(o *options) {
+		o.level = level
+	}
+}
+
+// WithClock sets the function providing the time of log messages. By default
+// time.Now is used.
+func WithClock(clock func() time.Time) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithCaller enables capturing the call site of each emitted log message in
+// Values.Caller. Capturing the call site has a cost, so it is disabled by
+// default. Wrappers around the Logger must use telemetry.AddCallerSkip to
+// have the call site of their callers captured.
+func WithCaller() Option {
+	return func(o *options) {
+		o.caller = true
+	}
+}
+
+// WithHooks adds Hooks called with the Record of each log message before it
+// is emitted, in the order they were added.
+func WithHooks(hooks ...Hook) Option {
+	return func(o *options) {
+		o.hooks = append(o.hooks[:len(o.hooks):len(o.hooks)], hooks...)
+	}
+}
+
+// WithMetricPolicy sets when the Metric attached to the Logger is recorded. By
+// default MetricAlways is used.
+func WithMetricPolicy(policy MetricPolicy) Option {
+	return func(o *options) {
+		o.metricPolicy = policy
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package function
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+func TestRecordLogger(t *testing.T) {
+	var (
+		records []Record
+		now     = time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	)
+	logger := NewRecordLogger(func(r Record) { records = append(records, r) },
+		WithLevel(telemetry.LevelDebug),
+		WithClock(func() time.Time { return now }),
+		WithHooks(func(r *Record) { r.Values.FromMethod = append(r.Values.FromMethod, "hooked", true) }),
+	)
+
+	if logger.Level() != telemetry.LevelDebug {
+		t.Fatalf("Level()=%v, want: %v", logger.Level(), telemetry.LevelDebug)
+	}
+
+	scoped := logger.With("scope", "test")
+	logger.Debug("first")
+	scoped.Clone().Info("second", "key", "value")
+	scoped.With("scope", "nested").Error("third", nil)
+
+	want := []Record{
+		{Time: now, Level: telemetry.LevelDebug, Message: "first", Sequence: 1,
+			Values: Values{FromMethod: []interface{}{"hooked", true}}},
+		{Time: now, Level: telemetry.LevelInfo, Message: "second", Name: "test", Sequence: 2,
+			Values: Values{FromLogger: []interface{}{"scope", "test"}, FromMethod: []interface{}{"key", "value", "hooked", true}}},
+		{Time: now, Level: telemetry.LevelError, Message: "third", Name: "nested", Sequence: 3,
+			Values: Values{FromLogger: []interface{}{"scope", "test", "scope", "nested"}, FromMethod: []interface{}{"hooked", true}}},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Fatalf("records=%+v\nwant: %+v", records, want)
+	}
+}
+
+func TestWithLevel(t *testing.T) {
+	tests := []struct {
+		level telemetry.Level
+		want  telemetry.Level
+	}{
+		{telemetry.LevelNone, telemetry.LevelNone},
+		{telemetry.LevelError, telemetry.LevelError},
+		{telemetry.LevelInfo + 1, telemetry.LevelInfo},
+		{telemetry.LevelDebug + 1, telemetry.LevelDebug},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			if have := NewLogger(nil, WithLevel(tt.level)).Level(); have != tt.want {
+				t.Fatalf("Level()=%v, want: %v", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy MetricPolicy
+		want   float64
+	}{
+		{"always", MetricAlways, 2},
+		{"when-enabled", MetricWhenEnabled, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metric := mockMetric{}
+			logger := NewLogger(func(telemetry.Level, string, error, Values) {},
+				WithLevel(telemetry.LevelError), WithMetricPolicy(tt.policy)).Metric(&metric)
+
+			logger.Info("silenced")
+			logger.Error("emitted", nil)
+
+			if metric.count != tt.want {
+				t.Fatalf("metric.count=%v, want: %v", metric.count, tt.want)
+			}
+		})
+	}
+}
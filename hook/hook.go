@@ -0,0 +1,336 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hook provides forwarding of Error log lines to handlers such as
+// crash reporters or alert queues.
+package hook
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/scope"
+)
+
+// DefaultQueueSize is the default number of Events queued for dispatch before
+// new Events are dropped.
+const DefaultQueueSize = 256
+
+// Event holds the data of an Error log call.
+type Event struct {
+	// Time of the log call.
+	Time time.Time
+	// Scope holds the name of the scope the Logger belongs to, if any.
+	Scope string
+	// Message of the log call.
+	Message string
+	// Err holds the error passed to the log call.
+	Err error
+	// KeyValues holds the merged key-value pairs found in Context, added with
+	// With, passed to the log call and carried by the error, in that order.
+	KeyValues []interface{}
+	// Context attached to the Logger.
+	Context context.Context
+}
+
+// Handler handles forwarded Events. Handlers are called sequentially from a
+// dedicated goroutine.
+type Handler func(Event)
+
+// Option implements a functional option type for Hooks.
+type Option func(*options)
+
+type options struct {
+	queueSize int
+	transform func(keyValuePairs []interface{}) []interface{}
+}
+
+// WithQueueSize sets the maximum number of Events queued for dispatch.
+func WithQueueSize(size int) Option {
+	return func(o *options) {
+		o.queueSize = size
+	}
+}
+
+// WithKeyValueTransform sets a function applied to the KeyValues of every
+// Event before it is handed to the Handlers, e.g. the KeyValues method of a
+// redact.Policy so Handlers forwarding Events to external services don't leak
+// sensitive values. The function is called from the dispatching goroutine.
+func WithKeyValueTransform(transform func(keyValuePairs []interface{}) []interface{}) Option {
+	return func(o *options) {
+		o.transform = transform
+	}
+}
+
+// Hooks dispatches Events of Error log calls to registered Handlers without
+// blocking the caller. If Handlers can't keep up and the queue is full, new
+// Events are dropped.
+type Hooks struct {
+	mu       sync.RWMutex
+	handlers []Handler
+
+	transform func(keyValuePairs []interface{}) []interface{}
+	queue     chan dispatch
+	dropped   uint64
+	closed    chan struct{}
+	stopped   chan struct{}
+	once      sync.Once
+}
+
+// dispatch holds a queued Event. A dispatch with a done channel is a flush
+// marker which is closed once all preceding Events are handled.
+type dispatch struct {
+	event Event
+	done  chan struct{}
+}
+
+// New returns Hooks dispatching Events on a dedicated goroutine. Close must be
+// called to stop the goroutine.
+func New(opts ...Option) *Hooks {
+	o := options{queueSize: DefaultQueueSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	h := &Hooks{
+		transform: o.transform,
+		queue:     make(chan dispatch, o.queueSize),
+		closed:    make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go h.run()
+	return h
+}
+
+// Register adds a Handler receiving the Events of all Loggers wrapped by
+// these Hooks.
+func (h *Hooks) Register(handler Handler) {
+	if handler == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handlers = append(h.handlers[:len(h.handlers):len(h.handlers)], handler)
+}
+
+// Logger returns a Logger forwarding every Error call to the registered
+// Handlers, independent of the configured level, before passing it on to the
+// provided Logger. Levels are shared with the wrapped Logger.
+func (h *Hooks) Logger(logger telemetry.Logger) telemetry.Logger {
+	return &Logger{logger: telemetry.AddCallerSkip(logger, 1), ctx: context.Background(), hooks: h}
+}
+
+// Dropped returns the number of Events dropped due to a full queue.
+func (h *Hooks) Dropped() uint64 { return atomic.LoadUint64(&h.dropped) }
+
+// Flush blocks until all Events queued before the call are handled or the
+// provided Context is done, in which case the Context error is returned.
+func (h *Hooks) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case h.queue <- dispatch{done: done}:
+	case <-h.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-h.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops the dispatching of Events after handling the queued ones or
+// once the provided Context is done. Events of Error calls after Close are
+// dropped.
+func (h *Hooks) Close(ctx context.Context) error {
+	h.once.Do(func() { close(h.closed) })
+	select {
+	case <-h.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// enqueue queues the Event without blocking.
+func (h *Hooks) enqueue(e Event) {
+	select {
+	case <-h.closed:
+		atomic.AddUint64(&h.dropped, 1)
+		return
+	default:
+	}
+	select {
+	case h.queue <- dispatch{event: e}:
+	default:
+		atomic.AddUint64(&h.dropped, 1)
+	}
+}
+
+// run dispatches queued Events until closed.
+func (h *Hooks) run() {
+	defer close(h.stopped)
+	for {
+		select {
+		case d := <-h.queue:
+			h.handle(d)
+		case <-h.closed:
+			for {
+				select {
+				case d := <-h.queue:
+					h.handle(d)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (h *Hooks) handle(d dispatch) {
+	if d.done != nil {
+		close(d.done)
+		return
+	}
+	h.mu.RLock()
+	handlers := h.handlers
+	h.mu.RUnlock()
+	if h.transform != nil {
+		d.event.KeyValues = h.transform(d.event.KeyValues)
+	}
+	for _, handler := range handlers {
+		call(handler, d.event)
+	}
+}
+
+// call invokes the Handler, making sure a panicking Handler does not stop the
+// dispatching of Events.
+func call(handler Handler, e Event) {
+	defer func() { _ = recover() }()
+	handler(e)
+}
+
+// Logger is a telemetry.Logger forwarding Error calls to Hooks.
+type Logger struct {
+	logger telemetry.Logger
+	ctx    context.Context
+	args   []interface{}
+	scope  string
+	hooks  *Hooks
+}
+
+// compile time check for compatibility with the telemetry.Logger and
+// telemetry.CallerSkipper interfaces.
+var (
+	_ telemetry.Logger        = (*Logger)(nil)
+	_ telemetry.CallerSkipper = (*Logger)(nil)
+)
+
+// Debug emits a log message at debug level.
+func (l *Logger) Debug(msg string, keyValues ...interface{}) {
+	l.logger.Debug(msg, keyValues...)
+}
+
+// Info emits a log message at info level.
+func (l *Logger) Info(msg string, keyValues ...interface{}) {
+	l.logger.Info(msg, keyValues...)
+}
+
+// Error forwards the log call to the Hooks and emits a log message at error
+// level.
+func (l *Logger) Error(msg string, err error, keyValues ...interface{}) {
+	fromContext := telemetry.KeyValuesFromContext(l.ctx)
+	var fromError []interface{}
+	if d := telemetry.InspectError(err); d != nil {
+		fromError = d.KeyValues
+	}
+	merged := make([]interface{}, 0, len(fromContext)+len(l.args)+len(keyValues)+1+len(fromError))
+	merged = append(merged, fromContext...)
+	merged = append(merged, l.args...)
+	merged = append(merged, keyValues...)
+	if len(keyValues)%2 != 0 {
+		merged = append(merged, "(MISSING)")
+	}
+	merged = append(merged, fromError...)
+
+	l.hooks.enqueue(Event{
+		Time:      time.Now(),
+		Scope:     l.scope,
+		Message:   msg,
+		Err:       err,
+		KeyValues: merged,
+		Context:   l.ctx,
+	})
+	l.logger.Error(msg, err, keyValues...)
+}
+
+// AddCallerSkip implements telemetry.CallerSkipper.
+func (l *Logger) AddCallerSkip(skip int) telemetry.Logger {
+	return &Logger{logger: telemetry.AddCallerSkip(l.logger, skip), ctx: l.ctx, args: l.args, scope: l.scope, hooks: l.hooks}
+}
+
+// Level returns the logging level of the wrapped Logger.
+func (l *Logger) Level() telemetry.Level { return l.logger.Level() }
+
+// SetLevel configures the logging level of the wrapped Logger.
+func (l *Logger) SetLevel(level telemetry.Level) { l.logger.SetLevel(level) }
+
+// With returns Logger with provided key value pairs attached.
+func (l *Logger) With(keyValues ...interface{}) telemetry.Logger {
+	if len(keyValues) == 0 {
+		return l
+	}
+	if len(keyValues)%2 != 0 {
+		keyValues = append(keyValues, "(MISSING)")
+	}
+	scopeName := l.scope
+	for i := 0; i < len(keyValues); i += 2 {
+		if k, ok := keyValues[i].(string); ok && k == scope.Key {
+			if name, ok := keyValues[i+1].(string); ok {
+				scopeName = name
+			}
+		}
+	}
+	return &Logger{
+		logger: l.logger.With(keyValues...),
+		ctx:    l.ctx,
+		args:   append(l.args[:len(l.args):len(l.args)], keyValues...),
+		scope:  scopeName,
+		hooks:  l.hooks,
+	}
+}
+
+// Context attaches provided Context to the Logger allowing metadata found in
+// this context to be used for log lines and Events.
+func (l *Logger) Context(ctx context.Context) telemetry.Logger {
+	return &Logger{logger: l.logger.Context(ctx), ctx: ctx, args: l.args, scope: l.scope, hooks: l.hooks}
+}
+
+// Metric attaches provided Metric to the wrapped Logger.
+func (l *Logger) Metric(m telemetry.Metric) telemetry.Logger {
+	return &Logger{logger: l.logger.Metric(m), ctx: l.ctx, args: l.args, scope: l.scope, hooks: l.hooks}
+}
+
+// Clone the current Logger and return it. The clone has its own level and
+// forwards to the same Hooks.
+func (l *Logger) Clone() telemetry.Logger {
+	return &Logger{logger: l.logger.Clone(), ctx: l.ctx, args: l.args, scope: l.scope, hooks: l.hooks}
+}
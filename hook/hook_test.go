@@ -0,0 +1,130 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hook
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/function"
+	"github.com/tetratelabs/telemetry/redact"
+	"github.com/tetratelabs/telemetry/scope"
+)
+
+func TestHooks(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []Event
+		lines  int
+	)
+	hooks := New()
+	defer func() { _ = hooks.Close(context.Background()) }()
+	hooks.Register(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	})
+	hooks.Register(func(Event) { panic("misbehaving handler") })
+
+	logger := hooks.Logger(function.NewLogger(func(telemetry.Level, string, error, function.Values) { lines++ }))
+	logger.SetLevel(telemetry.LevelNone)
+
+	ctx := telemetry.KeyValuesToContext(context.Background(), "ctx", "value")
+	err := telemetry.Errorf("error: %w", errors.New("cause")).With("err", "value")
+	l := logger.Context(ctx).With(scope.Key, "hooks", "key", "value")
+	l.Info("not forwarded")
+	l.Error("failed", err, "odd")
+	l.Clone().Error("cloned", nil)
+
+	if e := hooks.Flush(context.Background()); e != nil {
+		t.Fatal(e)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 {
+		t.Fatalf("len(events)=%d, want: 2", len(events))
+	}
+	e := events[0]
+	want := []interface{}{"ctx", "value", scope.Key, "hooks", "key", "value", "odd", "(MISSING)", "err", "value"}
+	if e.Message != "failed" || e.Err != err || e.Scope != "hooks" || e.Context != ctx || e.Time.IsZero() {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	if !reflect.DeepEqual(e.KeyValues, want) {
+		t.Fatalf("KeyValues=%v, want: %v", e.KeyValues, want)
+	}
+	if events[1].Message != "cloned" || events[1].Scope != "hooks" {
+		t.Fatalf("unexpected event %+v", events[1])
+	}
+	if lines != 0 {
+		t.Fatalf("expected no log lines at level none, got %d", lines)
+	}
+}
+
+func TestHooksKeyValueTransform(t *testing.T) {
+	var events []Event
+	hooks := New(WithKeyValueTransform(redact.NewPolicy().KeyValues))
+	hooks.Register(func(e Event) { events = append(events, e) })
+
+	logger := hooks.Logger(telemetry.NoopLogger())
+	ctx := telemetry.KeyValuesToContext(context.Background(), "token", "abc")
+	logger.Context(ctx).With("user", "jane").Error("failed", errors.New("error"), "password", "secret")
+
+	if err := hooks.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{"token", redact.DefaultMask, "user", "jane", "password", redact.DefaultMask}
+	if len(events) != 1 || !reflect.DeepEqual(events[0].KeyValues, want) {
+		t.Fatalf("events=%+v, want KeyValues: %v", events, want)
+	}
+}
+
+func TestHooksNonBlocking(t *testing.T) {
+	var (
+		gate    = make(chan struct{})
+		started = make(chan struct{})
+		once    sync.Once
+	)
+	hooks := New(WithQueueSize(1))
+	hooks.Register(func(Event) {
+		once.Do(func() { close(started) })
+		<-gate
+	})
+	logger := hooks.Logger(telemetry.NoopLogger())
+
+	logger.Error("first", nil)
+	<-started
+	logger.Error("queued", nil)
+	logger.Error("dropped", nil)
+	if hooks.Dropped() != 1 {
+		t.Fatalf("Dropped()=%d, want: 1", hooks.Dropped())
+	}
+
+	close(gate)
+	if err := hooks.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	logger.Error("after close", nil)
+	if hooks.Dropped() != 2 {
+		t.Fatalf("Dropped()=%d, want: 2", hooks.Dropped())
+	}
+	if err := hooks.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interceptor
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryClient returns a grpc.UnaryClientInterceptor which adds the
+// allow-listed Context key-value pairs to the outgoing metadata, records the
+// RPC Metrics and logs the completed RPC.
+func (i *Interceptors) UnaryClient() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(i.toOutgoing(ctx), method, req, reply, cc, opts...)
+		i.observe(i.withLabels(ctx, method), ctx, i.clientHandled, i.clientLatency, "outbound grpc request", method, start, status.Code(err), err)
+		return err
+	}
+}
+
+// StreamClient returns a grpc.StreamClientInterceptor which adds the
+// allow-listed Context key-value pairs to the outgoing metadata, records the
+// RPC Metrics and logs the RPC once the stream has completed.
+func (i *Interceptors) StreamClient() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		done := func(err error) {
+			i.observe(i.withLabels(ctx, method), ctx, i.clientHandled, i.clientLatency, "outbound grpc stream", method, start, status.Code(err), err)
+		}
+		cs, err := streamer(i.toOutgoing(ctx), desc, cc, method, opts...)
+		if err != nil {
+			done(err)
+			return nil, err
+		}
+		s := &clientStream{ClientStream: cs, done: done, finished: make(chan struct{}), serverStreams: desc.ServerStreams}
+		go func() {
+			select {
+			case <-ctx.Done():
+				s.finish(status.FromContextError(ctx.Err()).Err())
+			case <-s.finished:
+			}
+		}()
+		return s, nil
+	}
+}
+
+// clientStream reports the completion of the wrapped grpc.ClientStream once
+// receiving a message returns an error, io.EOF indicating success, once the
+// single response of a client-streaming RPC is received or once the Context of
+// the stream is done.
+type clientStream struct {
+	grpc.ClientStream
+	once          sync.Once
+	done          func(err error)
+	finished      chan struct{}
+	serverStreams bool
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == io.EOF, err == nil && !s.serverStreams:
+		s.finish(nil)
+	case err != nil:
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *clientStream) CloseSend() error {
+	err := s.ClientStream.CloseSend()
+	if err != nil {
+		s.finish(status.Error(codes.Unknown, err.Error()))
+	}
+	return err
+}
+
+// finish reports the completion of the stream once.
+func (s *clientStream) finish(err error) {
+	s.once.Do(func() {
+		close(s.finished)
+		s.done(err)
+	})
+}
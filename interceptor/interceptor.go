@@ -0,0 +1,214 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package interceptor provides gRPC server and client interceptors producing
+// log lines and RPC metrics through the telemetry facades.
+package interceptor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+// RequestIDKey is the metadata and Context key holding the request ID. It is
+// propagated by default.
+const RequestIDKey = "x-request-id"
+
+// DefaultLatencyBounds holds the default histogram bounds in seconds used for
+// the RPC latency distributions.
+var DefaultLatencyBounds = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Option implements a functional option type for the Interceptors.
+type Option func(*options)
+
+type options struct {
+	keys          []string
+	latencyBounds []float64
+}
+
+// WithKeys provides the allow-list of Context key-value pair keys carried in
+// gRPC metadata. Metadata keys are lowercase, so keys are lowercased as well.
+// The RequestIDKey is always included.
+func WithKeys(keys ...string) Option {
+	return func(o *options) {
+		for _, k := range keys {
+			o.keys = append(o.keys, strings.ToLower(k))
+		}
+	}
+}
+
+// WithLatencyBounds overrides the histogram bounds in seconds of the RPC
+// latency distributions.
+func WithLatencyBounds(bounds []float64) Option {
+	return func(o *options) {
+		o.latencyBounds = bounds
+	}
+}
+
+// Interceptors holds the gRPC interceptors and the Metrics they record to.
+type Interceptors struct {
+	logger  telemetry.Logger
+	sink    telemetry.MetricSink
+	options options
+
+	service telemetry.Label
+	method  telemetry.Label
+	code    telemetry.Label
+
+	serverHandled telemetry.Metric
+	serverLatency telemetry.Metric
+	clientHandled telemetry.Metric
+	clientLatency telemetry.Metric
+}
+
+// New returns the gRPC Interceptors for the provided Logger and MetricSink.
+// The Metrics are created once on the MetricSink, so the Interceptors should be
+// shared across servers and client connections.
+func New(logger telemetry.Logger, sink telemetry.MetricSink, opts ...Option) *Interceptors {
+	o := options{
+		keys:          []string{RequestIDKey},
+		latencyBounds: DefaultLatencyBounds,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	i := &Interceptors{
+		logger:  logger,
+		sink:    sink,
+		options: o,
+		service: sink.NewLabel("grpc_service"),
+		method:  sink.NewLabel("grpc_method"),
+		code:    sink.NewLabel("grpc_code"),
+	}
+	labels := telemetry.WithLabels(i.service, i.method, i.code)
+	i.serverHandled = sink.NewSum("grpc_server_handled_total",
+		"Total number of RPCs completed on the server", labels)
+	i.serverLatency = sink.NewDistribution("grpc_server_handling_seconds",
+		"Duration of RPCs handled by the server", o.latencyBounds, labels, telemetry.WithUnit(telemetry.Seconds))
+	i.clientHandled = sink.NewSum("grpc_client_handled_total",
+		"Total number of RPCs completed by the client", labels)
+	i.clientLatency = sink.NewDistribution("grpc_client_handling_seconds",
+		"Duration of RPCs made by the client", o.latencyBounds, labels, telemetry.WithUnit(telemetry.Seconds))
+	return i
+}
+
+// withLabels returns a Context holding the service and method label values of
+// the provided full method name.
+func (i *Interceptors) withLabels(ctx context.Context, fullMethod string) context.Context {
+	service, method := splitMethod(fullMethod)
+	if lctx, err := i.sink.ContextWithLabels(ctx, i.service.Insert(service), i.method.Insert(method)); err == nil {
+		return lctx
+	}
+	return ctx
+}
+
+// observe records the RPC Metrics and writes the log line of a completed RPC.
+func (i *Interceptors) observe(ctx, logCtx context.Context, handled, latency telemetry.Metric,
+	msg, fullMethod string, start time.Time, code codes.Code, err error) {
+	duration := time.Since(start)
+	if lctx, lerr := i.sink.ContextWithLabels(ctx, i.code.Insert(code.String())); lerr == nil {
+		ctx = lctx
+	}
+	handled.RecordContext(ctx, 1)
+	latency.RecordContext(ctx, duration.Seconds())
+
+	service, method := splitMethod(fullMethod)
+	l := i.logger.Context(logCtx)
+	keyValues := []interface{}{
+		"grpc_service", service,
+		"grpc_method", method,
+		"grpc_code", code.String(),
+		"duration", duration,
+	}
+	if isServerError(code) {
+		l.Error(msg, err, keyValues...)
+		return
+	}
+	l.Info(msg, keyValues...)
+}
+
+// toOutgoing adds the allow-listed Context key-value pairs to the outgoing gRPC
+// metadata.
+func (i *Interceptors) toOutgoing(ctx context.Context) context.Context {
+	keyValuePairs := telemetry.KeyValuesFromContext(ctx)
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	var found bool
+	for _, key := range i.options.keys {
+		if value, ok := lookup(keyValuePairs, key); ok {
+			md.Set(key, value)
+			found = true
+		}
+	}
+	if !found {
+		return ctx
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// fromIncoming stores the allow-listed key-value pairs found in the incoming
+// gRPC metadata in the returned Context.
+func (i *Interceptors) fromIncoming(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	var keyValuePairs []interface{}
+	for _, key := range i.options.keys {
+		if values := md.Get(key); len(values) > 0 {
+			keyValuePairs = append(keyValuePairs, key, values[len(values)-1])
+		}
+	}
+	return telemetry.KeyValuesToContext(ctx, keyValuePairs...)
+}
+
+// lookup returns the last value stored for key in the provided key-value
+// pairs.
+func lookup(keyValuePairs []interface{}, key string) (value string, found bool) {
+	for i := 0; i+1 < len(keyValuePairs); i += 2 {
+		if k, ok := keyValuePairs[i].(string); ok && strings.ToLower(k) == key {
+			value, found = fmt.Sprint(keyValuePairs[i+1]), true
+		}
+	}
+	return
+}
+
+// splitMethod splits a full gRPC method name in the form of /service/method.
+func splitMethod(fullMethod string) (service, method string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.Index(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
+
+// isServerError reports whether the provided code indicates a condition to be
+// logged at Error level.
+func isServerError(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Unimplemented, codes.Internal,
+		codes.Unavailable, codes.DataLoss:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interceptor_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	testgrpc "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/function"
+	"github.com/tetratelabs/telemetry/interceptor"
+	"github.com/tetratelabs/telemetry/metrictest"
+)
+
+const healthService = "grpc.health.v1.Health"
+
+func TestInterceptors(t *testing.T) {
+	var (
+		serverOut, clientOut syncBuffer
+		serverSink           = metrictest.NewSink(nil)
+		clientSink           = metrictest.NewSink(nil)
+		server               = interceptor.New(function.NewLogger(emitter(&serverOut)), serverSink, interceptor.WithKeys("Tenant"))
+		client               = interceptor.New(function.NewLogger(emitter(&clientOut)), clientSink, interceptor.WithKeys("tenant"))
+		received             []interface{}
+	)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(server.UnaryServer(), func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+			handler grpc.UnaryHandler) (interface{}, error) {
+			received = telemetry.KeyValuesFromContext(ctx)
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(server.StreamServer()),
+	)
+	hs := health.NewServer()
+	hs.SetServingStatus("ok", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(client.UnaryClient()),
+		grpc.WithStreamInterceptor(client.StreamClient()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	hc := healthpb.NewHealthClient(conn)
+
+	tests := []struct {
+		name     string
+		call     func(ctx context.Context) error
+		method   string
+		code     codes.Code
+		expected string
+	}{
+		{
+			"unary-ok",
+			func(ctx context.Context) error {
+				_, err := hc.Check(ctx, &healthpb.HealthCheckRequest{Service: "ok"})
+				return err
+			},
+			"Check", codes.OK,
+			`level=info msg="grpc request" [x-request-id abc tenant acme grpc_service grpc.health.v1.Health grpc_method Check grpc_code OK`,
+		},
+		{
+			"unary-not-found",
+			func(ctx context.Context) error {
+				_, err := hc.Check(ctx, &healthpb.HealthCheckRequest{Service: "missing"})
+				return err
+			},
+			"Check", codes.NotFound,
+			`level=info msg="grpc request" [x-request-id abc tenant acme grpc_service grpc.health.v1.Health grpc_method Check grpc_code NotFound`,
+		},
+		{
+			"unary-unimplemented",
+			func(ctx context.Context) error {
+				return conn.Invoke(ctx, "/"+healthService+"/Missing", &healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{})
+			},
+			"Missing", codes.Unimplemented,
+			``,
+		},
+		{
+			"stream",
+			func(ctx context.Context) error {
+				ctx, cancel := context.WithCancel(ctx)
+				defer cancel()
+				stream, err := hc.Watch(ctx, &healthpb.HealthCheckRequest{Service: "ok"})
+				if err != nil {
+					return err
+				}
+				if _, err = stream.Recv(); err != nil {
+					return err
+				}
+				hs.Shutdown()
+				defer hs.Resume()
+				if _, err = stream.Recv(); err != nil {
+					return err
+				}
+				cancel()
+				_, err = stream.Recv()
+				return err
+			},
+			"Watch", codes.Canceled,
+			``,
+		},
+		{
+			"stream-canceled",
+			func(ctx context.Context) error {
+				ctx, cancel := context.WithCancel(ctx)
+				stream, err := hc.Watch(ctx, &healthpb.HealthCheckRequest{Service: "ok"})
+				if err != nil {
+					cancel()
+					return err
+				}
+				if _, err = stream.Recv(); err != nil {
+					cancel()
+					return err
+				}
+				// the stream is abandoned without receiving its final error
+				cancel()
+				return status.FromContextError(ctx.Err()).Err()
+			},
+			"Watch", codes.Canceled,
+			``,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverOut.Reset()
+			clientOut.Reset()
+			serverSink.Reset(t)
+			clientSink.Reset(t)
+			received = nil
+
+			ctx := telemetry.KeyValuesToContext(context.Background(),
+				interceptor.RequestIDKey, "abc", "tenant", "acme", "secret", "s3cr3t")
+			if err := tt.call(ctx); status.Code(err) != tt.code {
+				t.Fatalf("status.Code(%v)=%v, want: %v", err, status.Code(err), tt.code)
+			}
+
+			if tt.expected != "" && !strings.HasPrefix(serverOut.String(), tt.expected) {
+				t.Fatalf("expected %s to start with %s", serverOut.String(), tt.expected)
+			}
+			if strings.HasPrefix(tt.name, "unary") && tt.code != codes.Unimplemented {
+				want := fmt.Sprint([]interface{}{interceptor.RequestIDKey, "abc", "tenant", "acme"})
+				if fmt.Sprint(received) != want {
+					t.Fatalf("received %v, want: %v", received, want)
+				}
+			}
+
+			labels := metrictest.Labels{"grpc_service": healthService, "grpc_method": tt.method, "grpc_code": tt.code.String()}
+			// streams abandoned by the client complete asynchronously
+			waitFor(t, func() bool { return strings.Contains(clientOut.String(), "grpc_code "+tt.code.String()) })
+			clientSink.ExpectSum("grpc_client_handled_total", labels).Equals(1)
+			clientSink.ExpectDistribution("grpc_client_handling_seconds", labels).Count(1)
+			if tt.code == codes.Unimplemented {
+				// unknown methods never reach the server interceptors
+				return
+			}
+			waitFor(t, func() bool { return len(serverSink.Observations("grpc_server_handled_total")) == 1 })
+			serverSink.ExpectSum("grpc_server_handled_total", labels).Equals(1)
+			serverSink.ExpectDistribution("grpc_server_handling_seconds", labels).Count(1)
+		})
+	}
+}
+
+type testService struct {
+	testgrpc.UnimplementedTestServiceServer
+}
+
+func (testService) StreamingInputCall(stream testgrpc.TestService_StreamingInputCallServer) error {
+	size := 0
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&testgrpc.StreamingInputCallResponse{AggregatedPayloadSize: int32(size)})
+		}
+		if err != nil {
+			return err
+		}
+		size += len(req.GetPayload().GetBody())
+	}
+}
+
+func TestClientStreaming(t *testing.T) {
+	var (
+		out    syncBuffer
+		sink   = metrictest.NewSink(t)
+		client = interceptor.New(function.NewLogger(emitter(&out)), sink)
+	)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	testgrpc.RegisterTestServiceServer(srv, testService{})
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStreamInterceptor(client.StreamClient()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	stream, err := testgrpc.NewTestServiceClient(conn).StreamingInputCall(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{"a", "bc"} {
+		if err = stream.Send(&testgrpc.StreamingInputCallRequest{Payload: &testgrpc.Payload{Body: []byte(body)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GetAggregatedPayloadSize() != 3 {
+		t.Fatalf("AggregatedPayloadSize=%d, want: 3", res.GetAggregatedPayloadSize())
+	}
+
+	labels := metrictest.Labels{"grpc_service": "grpc.testing.TestService", "grpc_method": "StreamingInputCall", "grpc_code": "OK"}
+	sink.ExpectSum("grpc_client_handled_total", labels).Equals(1)
+	sink.ExpectDistribution("grpc_client_handling_seconds", labels).Count(1)
+	if !strings.Contains(out.String(), "grpc_code OK") {
+		t.Fatalf("unexpected client log line: %s", out.String())
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		if condition() {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("condition not met")
+}
+
+func emitter(w *syncBuffer) function.Emit {
+	return func(level telemetry.Level, msg string, err error, values function.Values) {
+		_, _ = fmt.Fprintf(w, "level=%v msg=%q", level, msg)
+		if err != nil {
+			_, _ = fmt.Fprintf(w, " err=%v", err)
+		}
+
+		all := append(values.FromContext, values.FromLogger...)
+		all = append(all, values.FromMethod...)
+		_, _ = fmt.Fprintf(w, " %v", all)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *syncBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
@@ -0,0 +1,57 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interceptor
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServer returns a grpc.UnaryServerInterceptor which stores the
+// allow-listed key-value pairs found in the incoming metadata in the handler
+// Context, records the RPC Metrics and logs the completed RPC.
+func (i *Interceptors) UnaryServer() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		ctx = i.withLabels(i.fromIncoming(ctx), info.FullMethod)
+		res, err := handler(ctx, req)
+		i.observe(ctx, ctx, i.serverHandled, i.serverLatency, "grpc request", info.FullMethod, start, status.Code(err), err)
+		return res, err
+	}
+}
+
+// StreamServer returns a grpc.StreamServerInterceptor which stores the
+// allow-listed key-value pairs found in the incoming metadata in the stream
+// Context, records the RPC Metrics and logs the completed RPC.
+func (i *Interceptors) StreamServer() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx := i.withLabels(i.fromIncoming(ss.Context()), info.FullMethod)
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		i.observe(ctx, ctx, i.serverHandled, i.serverLatency, "grpc stream", info.FullMethod, start, status.Code(err), err)
+		return err
+	}
+}
+
+// serverStream overrides the Context of the wrapped grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context { return s.ctx }
@@ -14,7 +14,10 @@
 
 package telemetry
 
-import "context"
+import (
+	"context"
+	"sync"
+)
 
 // Logger provides a simple yet powerful logging abstraction.
 type Logger interface {
@@ -68,6 +71,29 @@ type Logger interface {
 	Clone() Logger
 }
 
+// CallerSkipper is implemented by Loggers capturing the call site of log
+// lines. Logger wrappers that add stack frames between their callers and the
+// wrapped Logger use it to keep the captured call site correct.
+type CallerSkipper interface {
+	// AddCallerSkip returns a Logger sharing the level of the original Logger
+	// which skips the provided number of additional stack frames when
+	// capturing the call site.
+	AddCallerSkip(skip int) Logger
+}
+
+// AddCallerSkip returns a Logger skipping the provided number of additional
+// stack frames when capturing the call site, if the provided Logger implements
+// CallerSkipper. Otherwise the Logger is returned as is. A Logger wrapper
+// calling the wrapped Logger from its own logging methods typically calls
+// AddCallerSkip(logger, 1) and implements CallerSkipper itself by passing the
+// skip on to the wrapped Logger.
+func AddCallerSkip(logger Logger, skip int) Logger {
+	if cs, ok := logger.(CallerSkipper); ok && skip != 0 {
+		return cs.AddCallerSkip(skip)
+	}
+	return logger
+}
+
 // KeyValuesToContext takes provided Context, retrieves the already stored
 // key-value pairs from it, appends the in this function provided key-value
 // pairs and stores the result in the returned Context.
@@ -78,16 +104,72 @@ func KeyValuesToContext(ctx context.Context, keyValuePairs ...interface{}) conte
 	if len(keyValuePairs)%2 != 0 {
 		keyValuePairs = append(keyValuePairs, "(MISSING)")
 	}
-	args := KeyValuesFromContext(ctx)
-	args = append(args, keyValuePairs...)
+	args := storedKeyValues(ctx)
+	args = append(args[:len(args):len(args)], keyValuePairs...)
 	return context.WithValue(ctx, ctxKVP, args)
 }
 
 // KeyValuesFromContext retrieves key-value pairs that might be stored in the
-// provided Context. Logging implementations must use this function to retrieve
-// the key-value pairs they need to include if a Context object was attached to
+// provided Context, followed by the key-value pairs produced by the
+// ContextExtractors, such as the trace and span IDs of the SpanContext found in
+// Context. Logging implementations must use this function to retrieve the
+// key-value pairs they need to include if a Context object was attached to
 // them.
 func KeyValuesFromContext(ctx context.Context) (keyValuePairs []interface{}) {
+	keyValuePairs = storedKeyValues(ctx)
+	extractorsMu.RLock()
+	extractors := contextExtractors
+	extractorsMu.RUnlock()
+	for _, extract := range extractors {
+		extracted := extract(ctx)
+		if len(extracted) == 0 {
+			continue
+		}
+		if len(extracted)%2 != 0 {
+			extracted = append(extracted, "(MISSING)")
+		}
+		// never append into the slice stored in Context
+		keyValuePairs = append(keyValuePairs[:len(keyValuePairs):len(keyValuePairs)], extracted...)
+	}
+	return
+}
+
+// ContextExtractor is a function returning key-value pairs of interest found in
+// the provided Context, e.g. values stored by other libraries. The returned
+// key-value pairs are included by KeyValuesFromContext. A ContextExtractor is
+// called for each log line written with a Context attached, so it must be
+// cheap and return nil if the values it looks for are not found.
+type ContextExtractor func(ctx context.Context) []interface{}
+
+var (
+	extractorsMu sync.RWMutex
+	// contextExtractors holds the ContextExtractors consulted by
+	// KeyValuesFromContext. The slice is replaced, never modified, on
+	// registration so it can be iterated without holding the lock.
+	contextExtractors = []ContextExtractor{traceKeyValues}
+)
+
+// RegisterContextExtractor adds a ContextExtractor to the registry of values
+// of interest pulled from Context. This allows values stored in Context by
+// other libraries, e.g. an authenticated principal or the remaining deadline,
+// to be included in every log line written through Logger.Context. Extracted
+// key-value pairs follow the ones stored with KeyValuesToContext in the order
+// of registration. Extractors are typically registered at program
+// initialization and can't be removed.
+func RegisterContextExtractor(extractor ContextExtractor) {
+	if extractor == nil {
+		return
+	}
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+	extractors := make([]ContextExtractor, len(contextExtractors), len(contextExtractors)+1)
+	copy(extractors, contextExtractors)
+	contextExtractors = append(extractors, extractor)
+}
+
+// storedKeyValues retrieves the key-value pairs stored in the provided Context
+// by KeyValuesToContext.
+func storedKeyValues(ctx context.Context) (keyValuePairs []interface{}) {
 	keyValuePairs, _ = ctx.Value(ctxKVP).([]interface{})
 	return
 }
@@ -45,3 +45,45 @@ func TestRemoveFromContext(t *testing.T) {
 		t.Errorf("want: %+v\nhave: %+v\n", want, have)
 	}
 }
+
+func TestRegisterContextExtractor(t *testing.T) {
+	defer func(extractors []ContextExtractor) { contextExtractors = extractors }(contextExtractors)
+
+	type principalKey struct{}
+	RegisterContextExtractor(nil)
+	RegisterContextExtractor(func(ctx context.Context) []interface{} {
+		if p, ok := ctx.Value(principalKey{}).(string); ok {
+			return []interface{}{"principal", p}
+		}
+		return nil
+	})
+	RegisterContextExtractor(func(context.Context) []interface{} { return []interface{}{"odd"} })
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want []interface{}
+	}{
+		{"empty", context.Background(), []interface{}{"odd", "(MISSING)"}},
+		{"extracted", context.WithValue(context.Background(), principalKey{}, "alice"),
+			[]interface{}{"principal", "alice", "odd", "(MISSING)"}},
+		{"stored-first", KeyValuesToContext(context.WithValue(context.Background(), principalKey{}, "alice"), "key", "value"),
+			[]interface{}{"key", "value", "principal", "alice", "odd", "(MISSING)"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if have := KeyValuesFromContext(tt.ctx); !reflect.DeepEqual(have, tt.want) {
+				t.Fatalf("KeyValuesFromContext()=%v, want: %v", have, tt.want)
+			}
+		})
+	}
+
+	// extracted values must not end up stored in Context
+	ctx := KeyValuesToContext(context.Background(), "key", "value")
+	ctx = KeyValuesToContext(ctx, "other", "value")
+	want := []interface{}{"key", "value", "other", "value", "odd", "(MISSING)"}
+	if have := KeyValuesFromContext(ctx); !reflect.DeepEqual(have, want) {
+		t.Fatalf("KeyValuesFromContext()=%v, want: %v", have, want)
+	}
+}
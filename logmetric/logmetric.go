@@ -0,0 +1,242 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logmetric provides a telemetry.Logger decorator turning log lines
+// into metrics without callers having to attach a Metric to their Loggers.
+package logmetric
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/scope"
+)
+
+const (
+	// MetricName is the name of the Sum counting log lines.
+	MetricName = "log_messages_total"
+
+	// DefaultMaxMessages is the default number of distinct message label
+	// values recorded before falling back to OtherMessage.
+	DefaultMaxMessages = 100
+
+	// OtherMessage is the message label value used once the maximum number of
+	// distinct message label values is reached.
+	OtherMessage = "other"
+
+	// maxFingerprintLength is the maximum length of a message fingerprint.
+	maxFingerprintLength = 64
+)
+
+// Option implements a functional option type for the logmetric Logger.
+type Option func(*options)
+
+type options struct {
+	maxMessages int
+	fingerprint func(msg string) string
+}
+
+// WithMaxMessages sets the maximum number of distinct message label values.
+// Log lines with messages beyond this limit are recorded with the
+// OtherMessage label value.
+func WithMaxMessages(n int) Option {
+	return func(o *options) {
+		o.maxMessages = n
+	}
+}
+
+// WithFingerprint overrides the function deriving the message label value from
+// a log message. By default Fingerprint is used.
+func WithFingerprint(fingerprint func(msg string) string) Option {
+	return func(o *options) {
+		o.fingerprint = fingerprint
+	}
+}
+
+// Fingerprint returns a stable label value for the provided log message.
+// Sequences of digits are replaced by a single '#', so messages holding
+// formatted numbers such as IDs, ports or durations share a fingerprint, and
+// the result is truncated to 64 bytes.
+func Fingerprint(msg string) string {
+	var (
+		b     strings.Builder
+		digit bool
+	)
+	for _, r := range msg {
+		if unicode.IsDigit(r) {
+			if !digit {
+				b.WriteByte('#')
+			}
+			digit = true
+			continue
+		}
+		digit = false
+		b.WriteRune(r)
+	}
+	fp := b.String()
+	if len(fp) > maxFingerprintLength {
+		fp = strings.ToValidUTF8(fp[:maxFingerprintLength], "")
+	}
+	return fp
+}
+
+// counter holds the Metric and message label state shared by all Loggers
+// derived from the same root Logger.
+type counter struct {
+	options
+	metric  telemetry.Metric
+	level   telemetry.Label
+	scope   telemetry.Label
+	message telemetry.Label
+
+	mu       sync.Mutex
+	messages map[string]struct{}
+}
+
+// increment records a log line, using the provided Context for additional
+// labels.
+func (c *counter) increment(ctx context.Context, level telemetry.Level, scopeName, msg string) {
+	c.metric.With(
+		c.level.Insert(level.String()),
+		c.scope.Insert(scopeName),
+		c.message.Insert(c.messageLabel(msg)),
+	).RecordContext(ctx, 1)
+}
+
+// messageLabel returns the message label value, protecting against unbounded
+// cardinality.
+func (c *counter) messageLabel(msg string) string {
+	fp := c.fingerprint(msg)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.messages[fp]; ok {
+		return fp
+	}
+	if len(c.messages) >= c.maxMessages {
+		return OtherMessage
+	}
+	c.messages[fp] = struct{}{}
+	return fp
+}
+
+// Logger is a telemetry.Logger counting the Info and Error log lines written
+// to the wrapped Logger.
+type Logger struct {
+	logger telemetry.Logger
+	// ctx holds the Context used to record the log_messages_total Sum.
+	ctx     context.Context
+	scope   string
+	counter *counter
+}
+
+// compile time check for compatibility with the telemetry.Logger and
+// telemetry.CallerSkipper interfaces.
+var (
+	_ telemetry.Logger        = (*Logger)(nil)
+	_ telemetry.CallerSkipper = (*Logger)(nil)
+)
+
+// New returns a Logger incrementing the log_messages_total Sum of the provided
+// MetricSink for every Info and Error call, regardless of the configured level,
+// before passing the call on to the wrapped Logger. The Sum is labeled by
+// level, scope and message fingerprint. The scope label holds the value added
+// with the scope.Key key, so wrapping the Logger provided to scope.UseLogger
+// counts log lines per scope.
+//
+// Metrics attached with Metric are passed on to the wrapped Logger and are
+// recorded in addition to the log_messages_total Sum.
+func New(logger telemetry.Logger, sink telemetry.MetricSink, opts ...Option) telemetry.Logger {
+	o := options{maxMessages: DefaultMaxMessages, fingerprint: Fingerprint}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	c := &counter{
+		options:  o,
+		level:    sink.NewLabel("level"),
+		scope:    sink.NewLabel("scope"),
+		message:  sink.NewLabel("message"),
+		messages: make(map[string]struct{}),
+	}
+	c.metric = sink.NewSum(MetricName, "Total number of log messages",
+		telemetry.WithLabels(c.level, c.scope, c.message))
+
+	return &Logger{logger: telemetry.AddCallerSkip(logger, 1), ctx: context.Background(), counter: c}
+}
+
+// Debug emits a log message at debug level. Debug log lines are not counted.
+func (l *Logger) Debug(msg string, keyValues ...interface{}) {
+	l.logger.Debug(msg, keyValues...)
+}
+
+// Info counts and emits a log message at info level.
+func (l *Logger) Info(msg string, keyValues ...interface{}) {
+	l.counter.increment(l.ctx, telemetry.LevelInfo, l.scope, msg)
+	l.logger.Info(msg, keyValues...)
+}
+
+// Error counts and emits a log message at error level.
+func (l *Logger) Error(msg string, err error, keyValues ...interface{}) {
+	l.counter.increment(l.ctx, telemetry.LevelError, l.scope, msg)
+	l.logger.Error(msg, err, keyValues...)
+}
+
+// AddCallerSkip implements telemetry.CallerSkipper.
+func (l *Logger) AddCallerSkip(skip int) telemetry.Logger {
+	return &Logger{logger: telemetry.AddCallerSkip(l.logger, skip), ctx: l.ctx, scope: l.scope, counter: l.counter}
+}
+
+// Level returns the logging level of the wrapped Logger.
+func (l *Logger) Level() telemetry.Level { return l.logger.Level() }
+
+// SetLevel configures the logging level of the wrapped Logger.
+func (l *Logger) SetLevel(level telemetry.Level) { l.logger.SetLevel(level) }
+
+// With returns Logger with provided key value pairs attached.
+func (l *Logger) With(keyValues ...interface{}) telemetry.Logger {
+	if len(keyValues) == 0 {
+		return l
+	}
+	scopeName := l.scope
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		if k, ok := keyValues[i].(string); ok && k == scope.Key {
+			if name, ok := keyValues[i+1].(string); ok {
+				scopeName = name
+			}
+		}
+	}
+	return &Logger{logger: l.logger.With(keyValues...), ctx: l.ctx, scope: scopeName, counter: l.counter}
+}
+
+// Context attaches provided Context to the wrapped Logger and uses it to
+// record the log_messages_total Sum, allowing metadata found in this context
+// to be used for metrics labels.
+func (l *Logger) Context(ctx context.Context) telemetry.Logger {
+	return &Logger{logger: l.logger.Context(ctx), ctx: ctx, scope: l.scope, counter: l.counter}
+}
+
+// Metric attaches provided Metric to the wrapped Logger.
+func (l *Logger) Metric(m telemetry.Metric) telemetry.Logger {
+	return &Logger{logger: l.logger.Metric(m), ctx: l.ctx, scope: l.scope, counter: l.counter}
+}
+
+// Clone the current Logger and return it. The clone has its own level and
+// records to the same log_messages_total Sum.
+func (l *Logger) Clone() telemetry.Logger {
+	return &Logger{logger: l.logger.Clone(), ctx: l.ctx, scope: l.scope, counter: l.counter}
+}
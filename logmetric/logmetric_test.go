@@ -0,0 +1,110 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logmetric
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/function"
+	"github.com/tetratelabs/telemetry/metrictest"
+	"github.com/tetratelabs/telemetry/scope"
+)
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want string
+	}{
+		{"connection established", "connection established"},
+		{"retry 3 of 10 after 250ms", "retry # of # after #ms"},
+		{"listening on :8080", "listening on :#"},
+		{strings.Repeat("a", 70), strings.Repeat("a", 64)},
+		{strings.Repeat("a", 63) + "é", strings.Repeat("a", 63)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			if have := Fingerprint(tt.msg); have != tt.want {
+				t.Fatalf("Fingerprint(%q)=%q, want: %q", tt.msg, have, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogMetric(t *testing.T) {
+	sink := metrictest.NewSink(t)
+	logger := New(function.NewLogger(nil), sink, WithMaxMessages(2))
+	logger.SetLevel(telemetry.LevelNone)
+
+	logger.Debug("debug")
+	logger.Info("retry 1")
+	logger.Info("retry 2")
+	logger.With("key", "value").Error("failed", errors.New("error"))
+	logger.Clone().Info("another message")
+
+	tests := []struct {
+		labels metrictest.Labels
+		want   float64
+	}{
+		{metrictest.Labels{"level": "info", "scope": "", "message": "retry #"}, 2},
+		{metrictest.Labels{"level": "error", "scope": "", "message": "failed"}, 1},
+		{metrictest.Labels{"level": "info", "scope": "", "message": OtherMessage}, 1},
+		{metrictest.Labels{"level": "debug", "scope": "", "message": "debug"}, 0},
+	}
+
+	for _, tt := range tests {
+		sink.ExpectSum(MetricName, tt.labels).Equals(tt.want)
+	}
+}
+
+func TestScopes(t *testing.T) {
+	var (
+		sink   = metrictest.NewSink(t)
+		lines  []string
+		logger = New(function.NewLogger(func(level telemetry.Level, msg string, _ error, _ function.Values) {
+			lines = append(lines, fmt.Sprintf("level=%v msg=%q", level, msg))
+		}), sink)
+	)
+
+	a := logger.With(scope.Key, "logmetric-a")
+	b := logger.With(scope.Key, "logmetric-b")
+	a.Info("started")
+	a.Info("started")
+	b.With("key", "value").Error("failed", nil)
+
+	sink.ExpectSum(MetricName, metrictest.Labels{"level": "info", "scope": "logmetric-a", "message": "started"}).Equals(2)
+	sink.ExpectSum(MetricName, metrictest.Labels{"level": "error", "scope": "logmetric-b", "message": "failed"}).Equals(1)
+	if len(lines) != 3 {
+		t.Fatalf("expected log lines to be passed on, got %q", lines)
+	}
+}
+
+func TestContextLabels(t *testing.T) {
+	sink := metrictest.NewSink(t)
+	logger := New(function.NewLogger(nil), sink)
+
+	ctx, err := sink.ContextWithLabels(context.Background(), sink.NewLabel("scope").Insert("from-context"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	logger.Context(ctx).Info("started")
+
+	sink.ExpectSum(MetricName, metrictest.Labels{"level": "info", "scope": "from-context", "message": "started"}).Equals(1)
+}
@@ -67,7 +67,8 @@ type Metric interface {
 // state, but are not updated based on any specific event. Their value will be calculated
 // based on a value func that executes when the metrics are exported.
 //
-// At the moment, only a Gauge type is supported.
+// Gauges are supported by all DerivedMetricSinks, Sums by the ones implementing
+// DerivedSumSink.
 type DerivedMetric interface {
 	// Name returns the name value of a DerivedMetric.
 	Name() string
@@ -139,6 +140,15 @@ type DerivedMetricSink interface {
 	NewDerivedGauge(name, description string) DerivedMetric
 }
 
+// DerivedSumSink is implemented by DerivedMetricSinks able to create derived
+// Metrics with an aggregation type of Sum, for values which only increase.
+type DerivedSumSink interface {
+	// NewDerivedSum intents to create a new Metric with an aggregation type
+	// of Sum. Unlike NewSum, the DerivedSum accepts functions which are called
+	// to get the current cumulative value.
+	NewDerivedSum(name, description string, opts ...MetricOption) DerivedMetric
+}
+
 // MetricOption implements a functional option type for our Metrics.
 type MetricOption func(*MetricOptions)
 
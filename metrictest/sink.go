@@ -0,0 +1,507 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrictest provides a recording telemetry.MetricSink implementation
+// to assert on the measurements made by instrumented code in tests.
+package metrictest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+// Kind is the aggregation type of a Metric created by the Sink.
+type Kind string
+
+// Available Metric kinds.
+const (
+	KindSum          Kind = "sum"
+	KindGauge        Kind = "gauge"
+	KindDistribution Kind = "distribution"
+	KindDerivedGauge Kind = "derived-gauge"
+	KindDerivedSum   Kind = "derived-sum"
+)
+
+// Labels holds resolved label names and their values.
+type Labels map[string]string
+
+// String returns a stable representation of the Labels.
+func (l Labels) String() string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+l[k])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Observation holds a single recorded measurement.
+type Observation struct {
+	// Name of the Metric the measurement was recorded for.
+	Name string
+	// Kind of the Metric the measurement was recorded for.
+	Kind Kind
+	// Labels holds the label values resolved from Context and With.
+	Labels Labels
+	// Value holds the recorded value.
+	Value float64
+}
+
+var (
+	_ telemetry.MetricSink        = (*Sink)(nil)
+	_ telemetry.DerivedMetricSink = (*Sink)(nil)
+	_ telemetry.DerivedSumSink    = (*Sink)(nil)
+)
+
+// Sink is a telemetry.MetricSink, telemetry.DerivedMetricSink and
+// telemetry.DerivedSumSink which records every observation made through its
+// Metrics. It is safe for concurrent use.
+type Sink struct {
+	mu           sync.Mutex
+	t            testing.TB
+	kinds        map[string]Kind
+	units        map[string]telemetry.Unit
+	observations []Observation
+	derived      map[string]*derivedGauge
+}
+
+// NewSink returns a new recording Sink. Failed expectations are reported to
+// the provided testing.TB, which may be nil if the Sink is created before a
+// test is running, in which case Reset should be used to provide one. Without
+// a testing.TB, failures are only available through Expectation.Err.
+func NewSink(t testing.TB) *Sink {
+	return &Sink{
+		t:       t,
+		kinds:   make(map[string]Kind),
+		units:   make(map[string]telemetry.Unit),
+		derived: make(map[string]*derivedGauge),
+	}
+}
+
+// Reset removes all recorded observations and reports subsequent failed
+// expectations to the provided testing.TB. Metrics created before Reset
+// remain usable. This allows sharing a Sink between subtests.
+func (s *Sink) Reset(t testing.TB) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.t = t
+	s.observations = nil
+}
+
+// NewSum implements telemetry.MetricSink.
+func (s *Sink) NewSum(name, _ string, opts ...telemetry.MetricOption) telemetry.Metric {
+	return s.newMetric(name, KindSum, opts)
+}
+
+// NewGauge implements telemetry.MetricSink.
+func (s *Sink) NewGauge(name, _ string, opts ...telemetry.MetricOption) telemetry.Metric {
+	return s.newMetric(name, KindGauge, opts)
+}
+
+// NewDistribution implements telemetry.MetricSink.
+func (s *Sink) NewDistribution(name, _ string, _ []float64, opts ...telemetry.MetricOption) telemetry.Metric {
+	return s.newMetric(name, KindDistribution, opts)
+}
+
+// NewLabel implements telemetry.MetricSink.
+func (s *Sink) NewLabel(name string) telemetry.Label {
+	return label(name)
+}
+
+// ContextWithLabels implements telemetry.MetricSink.
+func (s *Sink) ContextWithLabels(ctx context.Context, values ...telemetry.LabelValue) (context.Context, error) {
+	for _, v := range values {
+		if _, ok := v.(labelValue); !ok {
+			return ctx, fmt.Errorf("unexpected label value type %T", v)
+		}
+	}
+	existing, _ := ctx.Value(ctxLabels).([]telemetry.LabelValue)
+	merged := make([]telemetry.LabelValue, 0, len(existing)+len(values))
+	merged = append(merged, existing...)
+	merged = append(merged, values...)
+	return context.WithValue(ctx, ctxLabels, merged), nil
+}
+
+// NewDerivedGauge implements telemetry.DerivedMetricSink.
+func (s *Sink) NewDerivedGauge(name, _ string) telemetry.DerivedMetric {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.kinds[name] = KindDerivedGauge
+	g := &derivedGauge{name: name}
+	s.derived[name] = g
+	return g
+}
+
+// NewDerivedSum implements telemetry.DerivedSumSink.
+func (s *Sink) NewDerivedSum(name, _ string, opts ...telemetry.MetricOption) telemetry.DerivedMetric {
+	var options telemetry.MetricOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.kinds[name] = KindDerivedSum
+	s.units[name] = options.Unit
+	g := &derivedGauge{name: name}
+	s.derived[name] = g
+	return g
+}
+
+// Unit returns the Unit the named Metric was created with.
+func (s *Sink) Unit(name string) telemetry.Unit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.units[name]
+}
+
+// Observations returns the observations recorded for the named Metric in
+// the order in which they were made.
+func (s *Sink) Observations(name string) []Observation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var obs []Observation
+	for _, o := range s.observations {
+		if o.Name == name {
+			obs = append(obs, o)
+		}
+	}
+	return obs
+}
+
+// ExpectSum returns an Expectation on the cumulative value of the named Sum
+// for the exact provided label set. For derived sums the value function is
+// evaluated when the Expectation is created.
+func (s *Sink) ExpectSum(name string, labels Labels) *Expectation {
+	s.mu.Lock()
+	kind := s.kinds[name]
+	s.mu.Unlock()
+	if kind == KindDerivedSum {
+		return s.expect(name, KindDerivedSum, labels)
+	}
+	return s.expect(name, KindSum, labels)
+}
+
+// ExpectGauge returns an Expectation on the last value of the named Gauge for
+// the exact provided label set. For derived gauges the value function is
+// evaluated when the Expectation is created.
+func (s *Sink) ExpectGauge(name string, labels Labels) *Expectation {
+	s.mu.Lock()
+	kind := s.kinds[name]
+	s.mu.Unlock()
+	if kind == KindDerivedGauge {
+		return s.expect(name, KindDerivedGauge, labels)
+	}
+	return s.expect(name, KindGauge, labels)
+}
+
+// ExpectDistribution returns an Expectation on the observations of the named
+// Distribution for the exact provided label set.
+func (s *Sink) ExpectDistribution(name string, labels Labels) *Expectation {
+	return s.expect(name, KindDistribution, labels)
+}
+
+func (s *Sink) expect(name string, kind Kind, labels Labels) *Expectation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if labels == nil {
+		labels = Labels{}
+	}
+	e := &Expectation{t: s.t, name: name, kind: kind, labels: labels}
+	if registered, ok := s.kinds[name]; !ok {
+		e.err = fmt.Sprintf("metric %q was never created", name)
+	} else if registered != kind {
+		e.err = fmt.Sprintf("metric %q is a %s, not a %s", name, registered, kind)
+	}
+
+	if kind == KindDerivedGauge || kind == KindDerivedSum {
+		if g, ok := s.derived[name]; ok {
+			if v, found := g.value(labels); found {
+				e.values = []float64{v}
+			}
+		}
+		return e
+	}
+	for _, o := range s.observations {
+		if o.Name == name && o.Labels.String() == labels.String() {
+			e.values = append(e.values, o.Value)
+		}
+	}
+	return e
+}
+
+func (s *Sink) newMetric(name string, kind Kind, opts []telemetry.MetricOption) telemetry.Metric {
+	var options telemetry.MetricOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	s.mu.Lock()
+	s.kinds[name] = kind
+	s.units[name] = options.Unit
+	s.mu.Unlock()
+
+	m := &metric{sink: s, name: name, kind: kind, enabled: options.EnabledCondition}
+	if len(options.Labels) > 0 {
+		m.allowed = make(map[string]bool, len(options.Labels))
+		for _, l := range options.Labels {
+			if n, ok := l.(label); ok {
+				m.allowed[string(n)] = true
+			}
+		}
+	}
+	return m
+}
+
+func (s *Sink) record(o Observation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.observations = append(s.observations, o)
+}
+
+// Expectation asserts on the values recorded for a Metric and label set.
+// Failed assertions are reported through Errorf of the Sink's testing.TB, if
+// any, and returned by Err.
+type Expectation struct {
+	t       testing.TB
+	name    string
+	kind    Kind
+	labels  Labels
+	values  []float64
+	err     string
+	failure error
+}
+
+// Equals asserts the value of the Metric. For Sums this is the cumulative
+// value, for Gauges the last recorded value and for Distributions the sum
+// of all observations.
+func (e *Expectation) Equals(want float64) bool {
+	if !e.check() {
+		return false
+	}
+	var have float64
+	switch e.kind {
+	case KindGauge, KindDerivedGauge:
+		if len(e.values) == 0 {
+			return e.fail("no value recorded")
+		}
+		have = e.values[len(e.values)-1]
+	default:
+		for _, v := range e.values {
+			have += v
+		}
+	}
+	if have != want {
+		return e.fail(fmt.Sprintf("want value %v, have %v", want, have))
+	}
+	return true
+}
+
+// Count asserts the number of recorded observations.
+func (e *Expectation) Count(want int) bool {
+	if !e.check() {
+		return false
+	}
+	if len(e.values) != want {
+		return e.fail(fmt.Sprintf("want %d observations, have %d", want, len(e.values)))
+	}
+	return true
+}
+
+// Values returns the recorded values in the order they were recorded.
+func (e *Expectation) Values() []float64 {
+	return e.values
+}
+
+func (e *Expectation) check() bool {
+	if e.err != "" {
+		return e.fail(e.err)
+	}
+	return true
+}
+
+// Err returns the failure of the last failed assertion, or nil if all
+// assertions passed.
+func (e *Expectation) Err() error {
+	return e.failure
+}
+
+func (e *Expectation) fail(msg string) bool {
+	e.failure = fmt.Errorf("%s %s%s: %s", e.kind, e.name, e.labels, msg)
+	if e.t != nil {
+		e.t.Helper()
+		e.t.Errorf("%v", e.failure)
+	}
+	return false
+}
+
+// metric implements telemetry.Metric.
+type metric struct {
+	sink        *Sink
+	name        string
+	kind        Kind
+	enabled     func() bool
+	allowed     map[string]bool
+	labelValues []telemetry.LabelValue
+}
+
+func (m *metric) Increment()   { m.Record(1) }
+func (m *metric) Decrement()   { m.Record(-1) }
+func (m *metric) Name() string { return m.name }
+
+func (m *metric) Record(value float64) {
+	m.RecordContext(context.Background(), value)
+}
+
+func (m *metric) RecordContext(ctx context.Context, value float64) {
+	if m.enabled != nil && !m.enabled() {
+		return
+	}
+	ctxValues, _ := ctx.Value(ctxLabels).([]telemetry.LabelValue)
+	labels := Labels{}
+	apply(labels, ctxValues)
+	apply(labels, m.labelValues)
+	if m.allowed != nil {
+		for k := range labels {
+			if !m.allowed[k] {
+				delete(labels, k)
+			}
+		}
+	}
+	m.sink.record(Observation{Name: m.name, Kind: m.kind, Labels: labels, Value: value})
+}
+
+func (m *metric) With(labelValues ...telemetry.LabelValue) telemetry.Metric {
+	return &metric{
+		sink:        m.sink,
+		name:        m.name,
+		kind:        m.kind,
+		enabled:     m.enabled,
+		allowed:     m.allowed,
+		labelValues: append(append([]telemetry.LabelValue{}, m.labelValues...), labelValues...),
+	}
+}
+
+// derivedGauge implements telemetry.DerivedMetric for derived gauges and sums.
+type derivedGauge struct {
+	mu   sync.Mutex
+	name string
+	fns  map[string]func() float64
+}
+
+func (g *derivedGauge) Name() string { return g.name }
+
+func (g *derivedGauge) ValueFrom(valueFn func() float64, labelValues ...telemetry.LabelValue) telemetry.DerivedMetric {
+	labels := Labels{}
+	apply(labels, labelValues)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.fns == nil {
+		g.fns = make(map[string]func() float64)
+	}
+	g.fns[labels.String()] = valueFn
+	return g
+}
+
+func (g *derivedGauge) value(labels Labels) (float64, bool) {
+	g.mu.Lock()
+	fn, ok := g.fns[labels.String()]
+	g.mu.Unlock()
+	if !ok {
+		return 0, false
+	}
+	return fn(), true
+}
+
+// label implements telemetry.Label.
+type label string
+
+type labelOp int
+
+const (
+	opInsert labelOp = iota
+	opUpdate
+	opUpsert
+	opDelete
+)
+
+type labelValue struct {
+	label label
+	op    labelOp
+	value string
+}
+
+func (l label) Insert(value string) telemetry.LabelValue {
+	return labelValue{label: l, op: opInsert, value: value}
+}
+
+func (l label) Update(value string) telemetry.LabelValue {
+	return labelValue{label: l, op: opUpdate, value: value}
+}
+
+func (l label) Upsert(value string) telemetry.LabelValue {
+	return labelValue{label: l, op: opUpsert, value: value}
+}
+
+func (l label) Delete() telemetry.LabelValue {
+	return labelValue{label: l, op: opDelete}
+}
+
+// apply processes the label value operations in sequence.
+func apply(labels Labels, values []telemetry.LabelValue) {
+	for _, v := range values {
+		lv, ok := v.(labelValue)
+		if !ok {
+			continue
+		}
+		key := string(lv.label)
+		_, exists := labels[key]
+		switch lv.op {
+		case opInsert:
+			if !exists {
+				labels[key] = lv.value
+			}
+		case opUpdate:
+			if exists {
+				labels[key] = lv.value
+			}
+		case opUpsert:
+			labels[key] = lv.value
+		case opDelete:
+			delete(labels, key)
+		}
+	}
+}
+
+type tCtxLabels string
+
+var ctxLabels tCtxLabels
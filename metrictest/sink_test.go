@@ -0,0 +1,183 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrictest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/function"
+)
+
+func TestSink(t *testing.T) {
+	sink := NewSink(nil)
+	method := sink.NewLabel("method")
+	code := sink.NewLabel("code")
+	requests := sink.NewSum("requests", "", telemetry.WithLabels(method, code))
+	latency := sink.NewDistribution("latency", "", []float64{1, 2}, telemetry.WithLabels(method))
+	inflight := sink.NewGauge("inflight", "")
+	logger := function.NewLogger(func(telemetry.Level, string, error, function.Values) {})
+
+	tests := []struct {
+		name   string
+		record func(ctx context.Context)
+		assert func(t *testing.T)
+	}{
+		{
+			"logger-metric",
+			func(ctx context.Context) {
+				l := logger.Context(ctx).Metric(requests.With(code.Insert("200")))
+				l.Info("ok")
+				l.Info("ok")
+				l.Error("failed", errors.New("error"))
+				l.Debug("not recorded")
+			},
+			func(t *testing.T) {
+				sink.ExpectSum("requests", Labels{"method": "GET", "code": "200"}).Equals(3)
+				sink.ExpectSum("requests", Labels{"method": "GET", "code": "200"}).Count(3)
+			},
+		},
+		{
+			"label-operations",
+			func(ctx context.Context) {
+				requests.With(code.Update("500")).RecordContext(ctx, 1)
+				requests.With(method.Insert("PUT"), code.Upsert("404")).RecordContext(ctx, 1)
+				requests.With(method.Delete()).RecordContext(ctx, 1)
+			},
+			func(t *testing.T) {
+				sink.ExpectSum("requests", Labels{"method": "GET"}).Equals(1)
+				sink.ExpectSum("requests", Labels{"method": "GET", "code": "404"}).Equals(1)
+				sink.ExpectSum("requests", nil).Equals(1)
+			},
+		},
+		{
+			"distribution",
+			func(ctx context.Context) {
+				latency.RecordContext(ctx, 0.5)
+				latency.RecordContext(ctx, 1.5)
+				latency.With(code.Insert("200")).RecordContext(ctx, 3)
+			},
+			func(t *testing.T) {
+				e := sink.ExpectDistribution("latency", Labels{"method": "GET"})
+				e.Count(3)
+				e.Equals(5)
+				if fmt.Sprint(e.Values()) != "[0.5 1.5 3]" {
+					t.Errorf("unexpected values: %v", e.Values())
+				}
+			},
+		},
+		{
+			"gauge",
+			func(context.Context) {
+				inflight.Increment()
+				inflight.Record(7)
+				inflight.Decrement()
+			},
+			func(t *testing.T) {
+				sink.ExpectGauge("inflight", nil).Equals(-1)
+				if len(sink.Observations("inflight")) != 3 {
+					t.Errorf("unexpected observations: %v", sink.Observations("inflight"))
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink.Reset(t)
+			ctx, err := sink.ContextWithLabels(context.Background(), method.Insert("GET"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.record(ctx)
+			tt.assert(t)
+		})
+	}
+}
+
+func TestSinkFailures(t *testing.T) {
+	sink := NewSink(nil)
+	sink.NewSum("sum", "").Record(2)
+	enabled := false
+	sink.NewSum("disabled", "", telemetry.WithEnabled(func() bool { return enabled })).Increment()
+
+	tests := []struct {
+		name   string
+		expect func() bool
+	}{
+		{"unknown", func() bool { return sink.ExpectSum("unknown", nil).Equals(0) }},
+		{"wrong-kind", func() bool { return sink.ExpectGauge("sum", nil).Equals(2) }},
+		{"wrong-value", func() bool { return sink.ExpectSum("sum", nil).Equals(3) }},
+		{"wrong-labels", func() bool { return sink.ExpectSum("sum", Labels{"a": "b"}).Count(1) }},
+		{"disabled", func() bool { return sink.ExpectSum("disabled", nil).Count(1) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recorder{TB: t}
+			sink.t = rec
+			if tt.expect() {
+				t.Fatal("expected expectation to fail")
+			}
+			if rec.errors != 1 {
+				t.Fatalf("errors=%d, want 1", rec.errors)
+			}
+		})
+	}
+
+	if _, err := sink.ContextWithLabels(context.Background(), "invalid"); err == nil {
+		t.Fatal("expected error on invalid label value")
+	}
+}
+
+func TestSinkFailuresWithoutTB(t *testing.T) {
+	sink := NewSink(nil)
+	sink.NewSum("sum", "").Record(2)
+
+	if e := sink.ExpectSum("sum", nil); !e.Equals(2) || e.Err() != nil {
+		t.Fatalf("Err()=%v, want: nil", e.Err())
+	}
+	e := sink.ExpectSum("sum", nil)
+	if e.Equals(3) {
+		t.Fatal("expected expectation to fail")
+	}
+	if want := "sum sum{}: want value 3, have 2"; e.Err() == nil || e.Err().Error() != want {
+		t.Fatalf("Err()=%v, want: %s", e.Err(), want)
+	}
+}
+
+func TestDerivedGauge(t *testing.T) {
+	sink := NewSink(t)
+	value := 1.0
+	g := sink.NewDerivedGauge("derived", "")
+	g.ValueFrom(func() float64 { return value })
+
+	sink.ExpectGauge("derived", nil).Equals(1)
+	value = 42
+	sink.ExpectGauge("derived", nil).Equals(42)
+	if g.Name() != "derived" {
+		t.Fatalf("Name()=%s, want derived", g.Name())
+	}
+}
+
+type recorder struct {
+	testing.TB
+	errors int
+}
+
+func (r *recorder) Errorf(string, ...interface{}) { r.errors++ }
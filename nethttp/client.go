@@ -0,0 +1,178 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nethttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+// DefaultSizeBounds holds the default histogram bounds in bytes used for the
+// response size distribution.
+var DefaultSizeBounds = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304}
+
+// transport implements http.RoundTripper.
+type transport struct {
+	base     http.RoundTripper
+	logger   telemetry.Logger
+	sink     telemetry.MetricSink
+	options  options
+	method   telemetry.Label
+	host     telemetry.Label
+	status   telemetry.Label
+	requests telemetry.Metric
+	errors   telemetry.Metric
+	latency  telemetry.Metric
+	size     telemetry.Metric
+}
+
+// NewTransport returns an http.RoundTripper wrapping the provided base
+// RoundTripper with outbound request logging and metrics. If base is nil,
+// http.DefaultTransport is used. The Metrics are created once on the provided
+// MetricSink, so the returned RoundTripper should be reused.
+//
+// The request ID, the SpanContext and, if a Propagator is configured, the
+// allow-listed key-value pairs found in the request Context are propagated as
+// headers. Log lines are written through Logger.Context with the request
+// Context at Info level, or Error level for transport errors and 5xx responses.
+func NewTransport(base http.RoundTripper, logger telemetry.Logger, sink telemetry.MetricSink, opts ...Option) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t := &transport{
+		base:    base,
+		logger:  logger,
+		sink:    sink,
+		options: newOptions(opts),
+		method:  sink.NewLabel("method"),
+		host:    sink.NewLabel("host"),
+		status:  sink.NewLabel("status"),
+	}
+	t.requests = sink.NewSum("http_client_requests_total",
+		"Total number of outbound HTTP requests",
+		telemetry.WithLabels(t.method, t.host, t.status))
+	t.errors = sink.NewSum("http_client_errors_total",
+		"Total number of outbound HTTP requests failing without a response",
+		telemetry.WithLabels(t.method, t.host))
+	t.latency = sink.NewDistribution("http_client_request_duration_seconds",
+		"Duration of outbound HTTP requests until response headers are received",
+		t.options.latencyBounds,
+		telemetry.WithLabels(t.method, t.host, t.status),
+		telemetry.WithUnit(telemetry.Seconds))
+	t.size = sink.NewDistribution("http_client_response_size_bytes",
+		"Size of outbound HTTP request response bodies",
+		DefaultSizeBounds,
+		telemetry.WithLabels(t.method, t.host, t.status),
+		telemetry.WithUnit(telemetry.Bytes))
+	return t
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	ctx := req.Context()
+
+	// RoundTrippers must not modify the provided request.
+	req = req.Clone(ctx)
+	if requestID, ok := lookup(telemetry.KeyValuesFromContext(ctx), RequestIDKey); ok && req.Header.Get(RequestIDKey) == "" {
+		req.Header.Set(RequestIDKey, fmt.Sprint(requestID))
+	}
+	if sc := telemetry.SpanContextFromContext(ctx); sc.IsValid() && req.Header.Get(telemetry.TraceparentHeader) == "" {
+		req.Header.Set(telemetry.TraceparentHeader, sc.Traceparent())
+	}
+	if t.options.propagator != nil {
+		t.options.propagator.Inject(ctx, req.Header)
+	}
+
+	if lctx, err := t.sink.ContextWithLabels(ctx, t.method.Insert(req.Method), t.host.Insert(req.URL.Host)); err == nil {
+		ctx = lctx
+	}
+
+	res, err := t.base.RoundTrip(req)
+	duration := time.Since(start)
+	l := t.logger.Context(req.Context())
+	keyValues := []interface{}{
+		"method", req.Method,
+		"host", req.URL.Host,
+		"path", req.URL.Path,
+	}
+
+	if err != nil {
+		t.errors.RecordContext(ctx, 1)
+		t.latency.RecordContext(ctx, duration.Seconds())
+		l.Error("outbound http request", err, append(keyValues, "duration", duration)...)
+		return nil, err
+	}
+
+	if lctx, lerr := t.sink.ContextWithLabels(ctx, t.status.Insert(strconv.Itoa(res.StatusCode))); lerr == nil {
+		ctx = lctx
+	}
+	t.requests.RecordContext(ctx, 1)
+	t.latency.RecordContext(ctx, duration.Seconds())
+	// The body of 101 Switching Protocols responses is the upgraded connection,
+	// an io.ReadWriteCloser, and is returned as is without recording its size.
+	if res.Body != nil && res.StatusCode != http.StatusSwitchingProtocols {
+		sizeCtx := ctx
+		res.Body = &countingBody{ReadCloser: res.Body, done: func(n int64) { t.size.RecordContext(sizeCtx, float64(n)) }}
+	}
+
+	keyValues = append(keyValues, "status", res.StatusCode, "duration", duration)
+	if res.StatusCode >= http.StatusInternalServerError {
+		l.Error("outbound http request", errors.New(http.StatusText(res.StatusCode)), keyValues...)
+	} else {
+		l.Info("outbound http request", keyValues...)
+	}
+	return res, nil
+}
+
+// countingBody counts the bytes read from a response body and reports the
+// total once the body is fully read or closed.
+type countingBody struct {
+	io.ReadCloser
+	n    int64
+	once sync.Once
+	done func(n int64)
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if err == io.EOF {
+		b.once.Do(func() { b.done(b.n) })
+	}
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	b.once.Do(func() { b.done(b.n) })
+	return b.ReadCloser.Close()
+}
+
+// lookup returns the last value stored for key in the provided key-value pairs.
+func lookup(keyValuePairs []interface{}, key string) (value interface{}, found bool) {
+	for i := 0; i+1 < len(keyValuePairs); i += 2 {
+		if k, ok := keyValuePairs[i].(string); ok && k == key {
+			value, found = keyValuePairs[i+1], true
+		}
+	}
+	return
+}
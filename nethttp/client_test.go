@@ -0,0 +1,167 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nethttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/baggage"
+	"github.com/tetratelabs/telemetry/function"
+	"github.com/tetratelabs/telemetry/metrictest"
+)
+
+func TestTransport(t *testing.T) {
+	var headers http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("hello world"))
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	var (
+		out    syncBuffer
+		sink   = metrictest.NewSink(nil)
+		client = &http.Client{Transport: NewTransport(nil, function.NewLogger(emitter(&out)), sink,
+			WithPropagator(baggage.New("tenant")))}
+	)
+
+	tests := []struct {
+		name     string
+		path     string
+		status   int
+		size     float64
+		expected string
+	}{
+		{"ok", "/ok", 200, 11, `level=info msg="outbound http request" [x-request-id abc tenant acme secret s3cr3t method GET host ` + host + ` path /ok status 200`},
+		{"server-error", "/fail", 502, 0, `level=error msg="outbound http request" err=Bad Gateway [x-request-id abc tenant acme secret s3cr3t method GET host ` + host + ` path /fail status 502`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out.Reset()
+			sink.Reset(t)
+
+			ctx := telemetry.KeyValuesToContext(context.Background(), RequestIDKey, "abc", "tenant", "acme", "secret", "s3cr3t")
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = io.ReadAll(res.Body)
+			_ = res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("status=%d, want: %d", res.StatusCode, tt.status)
+			}
+			if headers.Get(RequestIDKey) != "abc" || headers.Get(baggage.Header) != "tenant=acme" {
+				t.Fatalf("unexpected propagated headers: %v", headers)
+			}
+			if len(req.Header) != 0 {
+				t.Fatalf("original request was modified: %v", req.Header)
+			}
+			if !strings.HasPrefix(out.String(), tt.expected) {
+				t.Fatalf("expected %s to start with %s", out.String(), tt.expected)
+			}
+
+			labels := metrictest.Labels{"method": "GET", "host": host, "status": fmt.Sprint(tt.status)}
+			sink.ExpectSum("http_client_requests_total", labels).Equals(1)
+			sink.ExpectDistribution("http_client_request_duration_seconds", labels).Count(1)
+			sink.ExpectDistribution("http_client_response_size_bytes", labels).Equals(tt.size)
+		})
+	}
+}
+
+func TestTransportError(t *testing.T) {
+	var (
+		out    syncBuffer
+		sink   = metrictest.NewSink(t)
+		client = &http.Client{Transport: NewTransport(nil, function.NewLogger(emitter(&out)), sink)}
+	)
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	if _, err := client.Get(srv.URL); err == nil {
+		t.Fatal("expected request to closed server to fail")
+	}
+	if !strings.HasPrefix(out.String(), `level=error msg="outbound http request" err=`) {
+		t.Fatalf("unexpected log line %s", out.String())
+	}
+	sink.ExpectSum("http_client_errors_total", metrictest.Labels{"method": "GET", "host": u.Host}).Equals(1)
+	sink.ExpectSum("http_client_requests_total", nil).Count(0)
+}
+
+func TestTransportSwitchingProtocols(t *testing.T) {
+	var (
+		sink   = metrictest.NewSink(t)
+		client = &http.Client{Transport: NewTransport(nil, telemetry.NoopLogger(), sink)}
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack()=%v", err)
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_, _ = buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		_ = buf.Flush()
+		_, _ = io.Copy(conn, buf)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "echo")
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	rw, ok := res.Body.(io.ReadWriteCloser)
+	if !ok {
+		t.Fatalf("expected the 101 response body %T to be an io.ReadWriteCloser", res.Body)
+	}
+	if _, err = rw.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 4)
+	if _, err = io.ReadFull(rw, b); err != nil || string(b) != "ping" {
+		t.Fatalf("read %q, %v, want: ping", b, err)
+	}
+
+	labels := metrictest.Labels{"method": "GET", "host": u.Host, "status": "101"}
+	sink.ExpectSum("http_client_requests_total", labels).Equals(1)
+	sink.ExpectDistribution("http_client_response_size_bytes", nil).Count(0)
+}
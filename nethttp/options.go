@@ -0,0 +1,84 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nethttp
+
+import (
+	"net/http"
+
+	"github.com/tetratelabs/telemetry/baggage"
+)
+
+// RequestIDKey is the name of the HTTP header and the Context key used to hold
+// the request ID.
+const RequestIDKey = "x-request-id"
+
+// MaxRequestIDLength is the maximum length of a request ID received in the
+// RequestIDKey header. Longer request IDs are replaced by a generated one.
+const MaxRequestIDLength = 128
+
+// UnknownRoute is the route label value used when no WithRoute function is
+// provided.
+const UnknownRoute = "unknown"
+
+// DefaultLatencyBounds holds the default histogram bounds in seconds used for
+// the latency distributions.
+var DefaultLatencyBounds = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Option implements a functional option type for the instrumentation.
+type Option func(*options)
+
+type options struct {
+	route         func(*http.Request) string
+	propagator    *baggage.Propagator
+	latencyBounds []float64
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		route:         func(*http.Request) string { return UnknownRoute },
+		latencyBounds: DefaultLatencyBounds,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithRoute provides the function returning the route label value of a
+// request. By default all requests have the UnknownRoute label value, as using
+// the request path leads to high cardinality metrics if paths hold
+// identifiers. Routers typically expose the matched route template which
+// should be used instead.
+func WithRoute(route func(*http.Request) string) Option {
+	return func(o *options) {
+		o.route = route
+	}
+}
+
+// WithPropagator provides the baggage Propagator used to carry allow-listed
+// Context key-value pairs across process boundaries.
+func WithPropagator(p *baggage.Propagator) Option {
+	return func(o *options) {
+		o.propagator = p
+	}
+}
+
+// WithLatencyBounds overrides the histogram bounds in seconds of the latency
+// distribution.
+func WithLatencyBounds(bounds []float64) Option {
+	return func(o *options) {
+		o.latencyBounds = bounds
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nethttp provides net/http instrumentation producing log lines and
+// RED (rate, errors, duration) metrics through the telemetry facades.
+package nethttp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+// Middleware returns a function wrapping http.Handlers with request logging
+// and metrics. The Metrics are created once on the provided MetricSink, so the
+// returned function can be used to wrap multiple handlers.
+//
+// For each request, a request ID is ensured in the Context through
+// telemetry.KeyValuesToContext and a SpanContext received through the W3C
+// traceparent header is stored, so log lines hold the trace and span IDs. The
+// method and route metric labels are added to the request Context, so metrics
+// recorded by the wrapped handler pick them up.
+// When the handler returns, the request count and latency are recorded with the
+// additional status label and an access log line is written at Info level, or
+// Error level for 5xx responses. Requests whose handler panics are recorded
+// with the 500 status before the panic is propagated.
+func Middleware(logger telemetry.Logger, sink telemetry.MetricSink, opts ...Option) func(http.Handler) http.Handler {
+	o := newOptions(opts)
+
+	var (
+		method   = sink.NewLabel("method")
+		route    = sink.NewLabel("route")
+		status   = sink.NewLabel("status")
+		requests = sink.NewSum("http_server_requests_total",
+			"Total number of HTTP requests handled",
+			telemetry.WithLabels(method, route, status))
+		latency = sink.NewDistribution("http_server_request_duration_seconds",
+			"Duration of HTTP requests handled",
+			o.latencyBounds,
+			telemetry.WithLabels(method, route, status),
+			telemetry.WithUnit(telemetry.Seconds))
+	)
+
+	// record records the request metrics and writes the access log line.
+	record := func(ctx context.Context, r *http.Request, routeName string, rw *responseWriter, start time.Time) {
+		duration := time.Since(start)
+
+		mctx := ctx
+		if lctx, err := sink.ContextWithLabels(ctx, status.Insert(strconv.Itoa(rw.status))); err == nil {
+			mctx = lctx
+		}
+		requests.RecordContext(mctx, 1)
+		latency.RecordContext(mctx, duration.Seconds())
+
+		l := logger.Context(ctx)
+		keyValues := []interface{}{
+			"method", r.Method,
+			"route", routeName,
+			"path", r.URL.Path,
+			"status", rw.status,
+			"bytes", rw.bytes,
+			"duration", duration,
+			"remote", r.RemoteAddr,
+		}
+		if rw.status >= http.StatusInternalServerError {
+			l.Error("http request", errors.New(http.StatusText(rw.status)), keyValues...)
+			return
+		}
+		l.Info("http request", keyValues...)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ctx := r.Context()
+			if o.propagator != nil {
+				ctx = o.propagator.Extract(ctx, r.Header)
+			}
+			if sc, err := telemetry.ParseTraceparent(r.Header.Get(telemetry.TraceparentHeader)); err == nil {
+				ctx = telemetry.ContextWithSpanContext(ctx, sc)
+			}
+
+			requestID := r.Header.Get(RequestIDKey)
+			if !validRequestID(requestID) {
+				requestID = newRequestID()
+			}
+			ctx = telemetry.KeyValuesToContext(ctx, RequestIDKey, requestID)
+			w.Header().Set(RequestIDKey, requestID)
+
+			routeName := o.route(r)
+			if lctx, err := sink.ContextWithLabels(ctx,
+				method.Insert(r.Method), route.Insert(routeName),
+			); err == nil {
+				ctx = lctx
+			}
+
+			rw := &responseWriter{ResponseWriter: w}
+			defer func() {
+				// A panicking handler aborts the response, so it is recorded as
+				// a server error before the panic is propagated to net/http.
+				if p := recover(); p != nil {
+					rw.status = http.StatusInternalServerError
+					record(ctx, r, routeName, rw, start)
+					panic(p)
+				}
+			}()
+
+			next.ServeHTTP(rw, r.WithContext(ctx))
+			if rw.status == 0 {
+				rw.status = http.StatusOK
+			}
+			record(ctx, r, routeName, rw, start)
+		})
+	}
+}
+
+// responseWriter captures the status code and response size.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher if supported by the wrapped ResponseWriter.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if supported by the wrapped ResponseWriter.
+// Hijacked connections are recorded with the 101 Switching Protocols status
+// unless the handler wrote a status before.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// ReadFrom implements io.ReaderFrom, delegating to the wrapped ResponseWriter
+// if supported so sendfile and splice optimizations are kept.
+func (w *responseWriter) ReadFrom(r io.Reader) (int64, error) {
+	rf, ok := w.ResponseWriter.(io.ReaderFrom)
+	if !ok {
+		return io.Copy(writerOnly{w}, r)
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := rf.ReadFrom(r)
+	w.bytes += n
+	return n, err
+}
+
+// Push implements http.Pusher if supported by the wrapped ResponseWriter.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap returns the wrapped ResponseWriter for use by http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// writerOnly hides the ReadFrom method of the responseWriter, so io.Copy does
+// not call it recursively.
+type writerOnly struct{ io.Writer }
+
+// validRequestID returns whether the received request ID is non-empty, at
+// most MaxRequestIDLength long and only holds printable ASCII characters other
+// than space.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit hex encoded request ID.
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,300 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nethttp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/baggage"
+	"github.com/tetratelabs/telemetry/function"
+	"github.com/tetratelabs/telemetry/metrictest"
+)
+
+func TestMiddleware(t *testing.T) {
+	var (
+		out  syncBuffer
+		sink = metrictest.NewSink(nil)
+		mw   = Middleware(function.NewLogger(emitter(&out)), sink,
+			WithRoute(func(r *http.Request) string { return strings.Split(r.URL.Path, "/")[1] }),
+			WithPropagator(baggage.New("tenant")),
+		)
+		handlerRequestID interface{}
+		handler          = mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			kv := telemetry.KeyValuesFromContext(r.Context())
+			handlerRequestID = kv[len(kv)-1]
+			switch r.URL.Path {
+			case "/fail":
+				w.WriteHeader(http.StatusServiceUnavailable)
+			case "/missing":
+				http.NotFound(w, r)
+			default:
+				_, _ = w.Write([]byte("hello"))
+			}
+		}))
+	)
+
+	tests := []struct {
+		name      string
+		path      string
+		requestID string
+		expected  string
+		status    int
+	}{
+		{"ok", "/ok/1", "abc", `level=info msg="http request" [tenant acme x-request-id abc method GET route ok path /ok/1 status 200 bytes 5`, 200},
+		{"not-found", "/missing", "def", `level=info msg="http request" [tenant acme x-request-id def method GET route missing path /missing status 404 bytes 19`, 404},
+		{"server-error", "/fail", "ghi", `level=error msg="http request" err=Service Unavailable [tenant acme x-request-id ghi method GET route fail path /fail status 503 bytes 0`, 503},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out.Reset()
+			sink.Reset(t)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set(RequestIDKey, tt.requestID)
+			req.Header.Set(baggage.Header, "tenant=acme")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status=%d, want: %d", rec.Code, tt.status)
+			}
+			if rec.Header().Get(RequestIDKey) != tt.requestID || handlerRequestID != tt.requestID {
+				t.Fatalf("request id not propagated: header=%q, context=%v", rec.Header().Get(RequestIDKey), handlerRequestID)
+			}
+			if !strings.HasPrefix(out.String(), tt.expected) {
+				t.Fatalf("expected %s to start with %s", out.String(), tt.expected)
+			}
+
+			labels := metrictest.Labels{"method": "GET", "route": strings.Split(tt.path, "/")[1], "status": fmt.Sprint(tt.status)}
+			sink.ExpectSum("http_server_requests_total", labels).Equals(1)
+			sink.ExpectDistribution("http_server_request_duration_seconds", labels).Count(1)
+		})
+	}
+}
+
+func TestMiddlewareGeneratesRequestID(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+	}{
+		{"missing", ""},
+		{"too long", strings.Repeat("a", MaxRequestIDLength+1)},
+		{"control characters", "abc\x1b[31m"},
+		{"spaces", "a b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := metrictest.NewSink(t)
+			handler := Middleware(telemetry.NoopLogger(), sink)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/path", nil)
+			req.Header.Set(RequestIDKey, tt.requestID)
+			handler.ServeHTTP(rec, req)
+
+			if id := rec.Header().Get(RequestIDKey); len(id) != 32 {
+				t.Fatalf("unexpected generated request id %q", id)
+			}
+			sink.ExpectSum("http_server_requests_total", metrictest.Labels{"method": "POST", "route": UnknownRoute, "status": "200"}).Equals(1)
+		})
+	}
+}
+
+func TestTraceparentPropagation(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	var outbound string
+	upstream := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		outbound = r.Header.Get(telemetry.TraceparentHeader)
+	}))
+	defer upstream.Close()
+
+	var (
+		out    syncBuffer
+		logger = function.NewLogger(emitter(&out))
+		sink   = metrictest.NewSink(t)
+		client = &http.Client{Transport: NewTransport(nil, telemetry.NoopLogger(), sink)}
+	)
+	handler := Middleware(logger, sink)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, upstream.URL, nil)
+		if res, err := client.Do(req); err == nil {
+			_ = res.Body.Close()
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/path", nil)
+	req.Header.Set(RequestIDKey, "abc")
+	req.Header.Set(telemetry.TraceparentHeader, traceparent)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if outbound != traceparent {
+		t.Fatalf("outbound traceparent=%q, want: %q", outbound, traceparent)
+	}
+	expected := `[x-request-id abc trace_id 4bf92f3577b34da6a3ce929d0e0e4736 span_id 00f067aa0ba902b7 method GET`
+	if !strings.Contains(out.String(), expected) {
+		t.Fatalf("expected log line to contain %q, got %q", expected, out.String())
+	}
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	var (
+		out     syncBuffer
+		sink    = metrictest.NewSink(t)
+		handler = Middleware(function.NewLogger(emitter(&out)), sink)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			panic(http.ErrAbortHandler)
+		}))
+	)
+
+	func() {
+		defer func() {
+			if p := recover(); p != http.ErrAbortHandler {
+				t.Fatalf("recover()=%v, want: %v", p, http.ErrAbortHandler)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/path", nil))
+	}()
+
+	expected := `level=error msg="http request" err=Internal Server Error`
+	if !strings.HasPrefix(out.String(), expected) {
+		t.Fatalf("expected %s to start with %s", out.String(), expected)
+	}
+	labels := metrictest.Labels{"method": "GET", "route": UnknownRoute, "status": "500"}
+	sink.ExpectSum("http_server_requests_total", labels).Equals(1)
+	sink.ExpectDistribution("http_server_request_duration_seconds", labels).Count(1)
+}
+
+func TestMiddlewareHijack(t *testing.T) {
+	var (
+		out  syncBuffer
+		sink = metrictest.NewSink(t)
+		mw   = Middleware(function.NewLogger(emitter(&out)), sink)
+	)
+	srv := httptest.NewServer(mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := w.(http.Pusher).Push("/style.css", nil); err != http.ErrNotSupported {
+			t.Errorf("Push()=%v, want: %v", err, http.ErrNotSupported)
+		}
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack()=%v", err)
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_, _ = buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+		_ = buf.Flush()
+	})))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "test")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status=%d, want: %d", res.StatusCode, http.StatusSwitchingProtocols)
+	}
+	// The access log is written once the handler returns, after the response
+	// has been received.
+	for deadline := time.Now().Add(5 * time.Second); !strings.Contains(out.String(), "status 101"); {
+		if time.Now().After(deadline) {
+			t.Fatalf("missing access log line for the hijacked connection: %s", out.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	sink.ExpectSum("http_server_requests_total", metrictest.Labels{"method": "GET", "route": UnknownRoute, "status": "101"}).Equals(1)
+}
+
+func TestMiddlewareReadFrom(t *testing.T) {
+	var (
+		out     syncBuffer
+		sink    = metrictest.NewSink(t)
+		handler = Middleware(function.NewLogger(emitter(&out)), sink)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.Copy(w, strings.NewReader("hello"))
+		}))
+	)
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+
+	if string(body) != "hello" {
+		t.Fatalf("body=%q, want: %q", body, "hello")
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/path", nil))
+	if rec.Body.String() != "hello" {
+		t.Fatalf("body=%q, want: %q", rec.Body.String(), "hello")
+	}
+	if strings.Count(out.String(), "status 200 bytes 5") != 2 {
+		t.Fatalf("unexpected access log lines %s", out.String())
+	}
+	sink.ExpectSum("http_server_requests_total", metrictest.Labels{"method": "GET", "route": UnknownRoute, "status": "200"}).Equals(2)
+}
+
+func emitter(w io.Writer) function.Emit {
+	return func(level telemetry.Level, msg string, err error, values function.Values) {
+		_, _ = fmt.Fprintf(w, "level=%v msg=%q", level, msg)
+		if err != nil {
+			_, _ = fmt.Fprintf(w, " err=%v", err)
+		}
+
+		all := append(values.FromContext, values.FromLogger...)
+		all = append(all, values.FromMethod...)
+		_, _ = fmt.Fprintf(w, " %v", all)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *syncBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
@@ -34,3 +34,26 @@ func (n *noopLogger) With(...interface{}) Logger         { return n }
 func (n *noopLogger) Context(context.Context) Logger     { return n }
 func (n *noopLogger) Metric(Metric) Logger               { return n }
 func (n *noopLogger) Clone() Logger                      { return NoopLogger() }
+
+// NoopTracer returns a no-op tracer.
+func NoopTracer() Tracer {
+	return noopTracer{}
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ ...interface{}) (context.Context, Span) {
+	// The Context is returned as is, so a Span found in it remains the parent
+	// for instrumented code further down the call chain.
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...interface{})      {}
+func (noopSpan) AddEvent(string, ...interface{})   {}
+func (noopSpan) RecordError(error, ...interface{}) {}
+func (noopSpan) SetStatus(StatusCode, string)      {}
+func (noopSpan) End()                              {}
+func (noopSpan) IsRecording() bool                 { return false }
+func (noopSpan) SpanContext() SpanContext          { return SpanContext{} }
@@ -0,0 +1,199 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package redact provides masking of sensitive values found in log line
+// key-value pairs before they are emitted.
+package redact
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/function"
+)
+
+// DefaultMask is the default replacement of redacted values.
+const DefaultMask = "[REDACTED]"
+
+// DefaultKeys holds the keys whose values are redacted by default. Keys are
+// matched case-insensitively.
+var DefaultKeys = []string{"password", "secret", "token", "authorization", "cookie", "api_key"}
+
+// Redactor is implemented by value types that know how to redact themselves.
+// Values implementing Redactor found in key-value pairs are replaced by the
+// result of Redact, regardless of their key.
+type Redactor interface {
+	Redact() interface{}
+}
+
+// Option implements a functional option type for the Policy.
+type Option func(*Policy)
+
+// WithKeys adds keys whose values are redacted. Keys are matched
+// case-insensitively.
+func WithKeys(keys ...string) Option {
+	return func(p *Policy) {
+		for _, k := range keys {
+			p.keys[strings.ToLower(k)] = struct{}{}
+		}
+	}
+}
+
+// WithKeyPatterns adds patterns matching keys whose values are redacted, e.g.
+// `(?i)_token$`.
+func WithKeyPatterns(patterns ...*regexp.Regexp) Option {
+	return func(p *Policy) {
+		p.keyPatterns = append(p.keyPatterns, patterns...)
+	}
+}
+
+// WithValuePatterns adds patterns matching sensitive parts of string values,
+// e.g. `Bearer \S+`. Matches are replaced by the mask regardless of the key.
+func WithValuePatterns(patterns ...*regexp.Regexp) Option {
+	return func(p *Policy) {
+		p.valuePatterns = append(p.valuePatterns, patterns...)
+	}
+}
+
+// WithMask overrides the replacement of redacted values.
+func WithMask(mask string) Option {
+	return func(p *Policy) {
+		p.mask = mask
+	}
+}
+
+// Policy holds the redaction configuration. A Policy is safe for concurrent
+// use once created.
+type Policy struct {
+	mask          string
+	keys          map[string]struct{}
+	keyPatterns   []*regexp.Regexp
+	valuePatterns []*regexp.Regexp
+}
+
+// NewPolicy returns a Policy redacting the values of DefaultKeys and the
+// provided options.
+func NewPolicy(opts ...Option) *Policy {
+	p := &Policy{mask: DefaultMask, keys: make(map[string]struct{})}
+	WithKeys(DefaultKeys...)(p)
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Emit returns an Emit function redacting the key-value pairs added with
+// With, found in Context and passed to the logging method before passing them
+// on to the provided Emit function. This way function.Logger implementations
+// never see the sensitive values:
+//
+//	logger := function.NewLogger(policy.Emit(emit))
+func (p *Policy) Emit(emit function.Emit) function.Emit {
+	return func(level telemetry.Level, msg string, err error, values function.Values) {
+		emit(level, msg, err, p.values(values))
+	}
+}
+
+// EmitRecord returns an EmitRecord function redacting the key-value pairs of
+// the Record like Emit does, to be used with function.NewRecordLogger:
+//
+//	logger := function.NewRecordLogger(policy.EmitRecord(emitter.EmitRecord))
+func (p *Policy) EmitRecord(emit function.EmitRecord) function.EmitRecord {
+	return func(r function.Record) {
+		r.Values = p.values(r.Values)
+		emit(r)
+	}
+}
+
+// values returns the provided Values with sensitive values redacted,
+// including the ones carried by the error.
+func (p *Policy) values(values function.Values) function.Values {
+	values.FromContext = p.KeyValues(values.FromContext)
+	values.FromLogger = p.KeyValues(values.FromLogger)
+	values.FromMethod = p.KeyValues(values.FromMethod)
+	if values.FromError != nil {
+		d := p.errorDetails(*values.FromError)
+		values.FromError = &d
+	}
+	return values
+}
+
+// errorDetails returns a copy of the provided ErrorDetails with the key-value
+// pairs of the error and its wrapped errors redacted.
+func (p *Policy) errorDetails(d telemetry.ErrorDetails) telemetry.ErrorDetails {
+	d.KeyValues = p.KeyValues(d.KeyValues)
+	if len(d.Errors) > 0 {
+		errs := make([]telemetry.ErrorDetails, len(d.Errors))
+		for i, e := range d.Errors {
+			errs[i] = p.errorDetails(e)
+		}
+		d.Errors = errs
+	}
+	return d
+}
+
+// KeyValues returns the provided key-value pairs with sensitive values
+// redacted. The provided slice is never modified; if nothing needs redaction
+// it is returned as is, otherwise a redacted copy is returned.
+func (p *Policy) KeyValues(keyValuePairs []interface{}) []interface{} {
+	var redacted []interface{}
+	for i := 1; i < len(keyValuePairs); i += 2 {
+		v, changed := p.value(keyValuePairs[i-1], keyValuePairs[i])
+		if !changed {
+			continue
+		}
+		if redacted == nil {
+			redacted = make([]interface{}, len(keyValuePairs))
+			copy(redacted, keyValuePairs)
+		}
+		redacted[i] = v
+	}
+	if redacted == nil {
+		return keyValuePairs
+	}
+	return redacted
+}
+
+// value returns the redacted value for the provided key-value pair and
+// whether it differs from the original.
+func (p *Policy) value(key, value interface{}) (interface{}, bool) {
+	if r, ok := value.(Redactor); ok {
+		return r.Redact(), true
+	}
+	if k, ok := key.(string); ok && p.sensitiveKey(k) {
+		return p.mask, true
+	}
+	if s, ok := value.(string); ok && len(p.valuePatterns) > 0 {
+		masked := s
+		for _, re := range p.valuePatterns {
+			masked = re.ReplaceAllLiteralString(masked, p.mask)
+		}
+		return masked, masked != s
+	}
+	return value, false
+}
+
+// sensitiveKey returns true if values of the provided key must be redacted.
+func (p *Policy) sensitiveKey(key string) bool {
+	if _, ok := p.keys[strings.ToLower(key)]; ok {
+		return true
+	}
+	for _, re := range p.keyPatterns {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
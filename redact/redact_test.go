@@ -0,0 +1,137 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redact
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/function"
+)
+
+type creditCard string
+
+func (c creditCard) Redact() interface{} { return "****" + string(c[len(c)-4:]) }
+
+func TestKeyValues(t *testing.T) {
+	policy := NewPolicy(
+		WithKeys("X-Session"),
+		WithKeyPatterns(regexp.MustCompile(`(?i)_key$`)),
+		WithValuePatterns(regexp.MustCompile(`Bearer \S+`)),
+	)
+
+	tests := []struct {
+		name string
+		in   []interface{}
+		want []interface{}
+	}{
+		{"none", []interface{}{"user", "alice", "attempt", 1}, []interface{}{"user", "alice", "attempt", 1}},
+		{"default-keys", []interface{}{"Password", "hunter2", "token", 42}, []interface{}{"Password", DefaultMask, "token", DefaultMask}},
+		{"configured-key", []interface{}{"x-session", "abc"}, []interface{}{"x-session", DefaultMask}},
+		{"key-pattern", []interface{}{"aws_KEY", "abc", "keys", "abc"}, []interface{}{"aws_KEY", DefaultMask, "keys", "abc"}},
+		{"value-pattern", []interface{}{"header", "Bearer abc.def ok"}, []interface{}{"header", DefaultMask + " ok"}},
+		{"redactor", []interface{}{"card", creditCard("4111111111111111")}, []interface{}{"card", "****1111"}},
+		{"missing-value", []interface{}{"user", "alice", "password"}, []interface{}{"user", "alice", "password"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := append([]interface{}(nil), tt.in...)
+			if have := policy.KeyValues(in); !reflect.DeepEqual(have, tt.want) {
+				t.Fatalf("KeyValues()=%v, want: %v", have, tt.want)
+			}
+			if !reflect.DeepEqual(in, tt.in) {
+				t.Fatalf("input modified: %v", in)
+			}
+		})
+	}
+}
+
+func TestEmit(t *testing.T) {
+	var out bytes.Buffer
+	logger := function.NewLogger(NewPolicy(WithMask("***")).Emit(emitter(&out)))
+
+	ctx := telemetry.KeyValuesToContext(context.Background(), "authorization", "Basic dXNlcjpwYXNz")
+	logger.Context(ctx).With("password", "hunter2").Info("login", "user", "alice", "token", "abc")
+
+	expected := `level=info msg="login" [authorization *** password *** user alice token ***]`
+	if out.String() != expected {
+		t.Fatalf("out=%q, want: %q", out.String(), expected)
+	}
+	if kvs := telemetry.KeyValuesFromContext(ctx); kvs[1] != "Basic dXNlcjpwYXNz" {
+		t.Fatalf("Context key-value pairs modified: %v", kvs)
+	}
+}
+
+func TestEmitRecord(t *testing.T) {
+	var records []function.Record
+	logger := function.NewRecordLogger(NewPolicy().EmitRecord(func(r function.Record) {
+		records = append(records, r)
+	}))
+
+	err := telemetry.Errorf("login failed").With("password", "hunter2", "user", "alice")
+	logger.With("token", "abc").Error("login", err, "api_key", "xyz")
+
+	if len(records) != 1 {
+		t.Fatalf("len(records)=%d, want: 1", len(records))
+	}
+	values := records[0].Values
+	if want := []interface{}{"token", DefaultMask}; !reflect.DeepEqual(values.FromLogger, want) {
+		t.Fatalf("FromLogger=%v, want: %v", values.FromLogger, want)
+	}
+	want := []interface{}{"api_key", DefaultMask, "password", DefaultMask, "user", "alice"}
+	if !reflect.DeepEqual(values.FromMethod, want) {
+		t.Fatalf("FromMethod=%v, want: %v", values.FromMethod, want)
+	}
+	want = []interface{}{"password", DefaultMask, "user", "alice"}
+	if !reflect.DeepEqual(values.FromError.KeyValues, want) {
+		t.Fatalf("FromError.KeyValues=%v, want: %v", values.FromError.KeyValues, want)
+	}
+	if kvs := err.KeyValues(); kvs[1] != "hunter2" {
+		t.Fatalf("Error key-value pairs modified: %v", kvs)
+	}
+}
+
+func TestEmitErrorDetails(t *testing.T) {
+	var details *telemetry.ErrorDetails
+	logger := function.NewLogger(NewPolicy().Emit(func(_ telemetry.Level, _ string, _ error, values function.Values) {
+		details = values.FromError
+	}))
+
+	logger.Error("failed", telemetry.Errorf("failed").With("secret", "s3cr3t"))
+
+	if want := []interface{}{"secret", DefaultMask}; details == nil || !reflect.DeepEqual(details.KeyValues, want) {
+		t.Fatalf("FromError=%+v, want KeyValues: %v", details, want)
+	}
+}
+
+func emitter(w io.Writer) function.Emit {
+	return func(level telemetry.Level, msg string, err error, values function.Values) {
+		_, _ = fmt.Fprintf(w, "level=%v msg=%q", level, msg)
+		if err != nil {
+			_, _ = fmt.Fprintf(w, " err=%v", err)
+		}
+
+		all := append(values.FromContext, values.FromLogger...)
+		all = append(all, values.FromMethod...)
+		_, _ = fmt.Fprintf(w, " %v", all)
+	}
+}
@@ -0,0 +1,460 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rotate provides an io.Writer writing to a log file which is rotated
+// by size and age, to be used with the function package emitters when logging
+// to files.
+package rotate
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultMaxSize is the default maximum size in bytes of a log file before it
+// is rotated.
+const DefaultMaxSize = 100 << 20
+
+// backupTimeFormat is the format of the timestamp added to the names of
+// rotated log files.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// compressSuffix is the suffix of compressed rotated log files.
+const compressSuffix = ".gz"
+
+// ErrClosed is returned when writing to a closed Writer.
+var ErrClosed = errors.New("rotate: writer closed")
+
+// Option implements a functional option type for the Writer.
+type Option func(*options)
+
+type options struct {
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+	maxAge     time.Duration
+	compress   bool
+	signals    []os.Signal
+	now        func() time.Time
+	rename     func(oldpath, newpath string) error
+}
+
+// WithMaxSize sets the maximum size in bytes of the log file before it is
+// rotated. Zero or less disables rotation by size.
+func WithMaxSize(size int64) Option {
+	return func(o *options) {
+		o.maxSize = size
+	}
+}
+
+// WithInterval rotates the log file once it has been written to for the given
+// duration. By default log files are not rotated by time.
+func WithInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.interval = interval
+	}
+}
+
+// WithMaxBackups sets the maximum number of rotated log files to retain. By
+// default all rotated log files are retained.
+func WithMaxBackups(n int) Option {
+	return func(o *options) {
+		o.maxBackups = n
+	}
+}
+
+// WithMaxAge sets the maximum age of rotated log files to retain, based on the
+// time of rotation. By default rotated log files are retained regardless of
+// their age.
+func WithMaxAge(age time.Duration) Option {
+	return func(o *options) {
+		o.maxAge = age
+	}
+}
+
+// WithCompress gzip-compresses rotated log files in the background.
+func WithCompress() Option {
+	return func(o *options) {
+		o.compress = true
+	}
+}
+
+// WithReopenOnSignal reopens the log file when one of the provided signals is
+// received, SIGHUP if none are provided. This allows external tools like
+// logrotate to move the log file away and signal the process to start writing
+// a new one.
+func WithReopenOnSignal(signals ...os.Signal) Option {
+	return func(o *options) {
+		if len(signals) == 0 {
+			signals = []os.Signal{syscall.SIGHUP}
+		}
+		o.signals = signals
+	}
+}
+
+// Writer is an io.Writer writing to a log file which is rotated by size and
+// time. Rotated log files are renamed by adding the time of rotation to the
+// file name, e.g. "app-2023-01-02T03-04-05.000.log" for "app.log". It is safe
+// for concurrent use.
+type Writer struct {
+	options
+	filename string
+
+	mu sync.Mutex
+	// file holds the open log file. It is nil if the Writer is closed or if
+	// opening the log file failed, in which case it is retried on next use.
+	file     *os.File
+	closed   bool
+	size     int64
+	openedAt time.Time
+
+	// mill triggers the background compression and removal of rotated log
+	// files.
+	mill chan struct{}
+	// done is closed when the Writer is closed, stopping the signal handling.
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New returns a Writer writing to the named log file, creating it and its
+// directory if needed. Log files are rotated when they reach DefaultMaxSize
+// unless configured otherwise.
+func New(filename string, opts ...Option) (*Writer, error) {
+	o := options{maxSize: DefaultMaxSize, now: time.Now, rename: os.Rename}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	w := &Writer{
+		options:  o,
+		filename: filename,
+		mill:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	w.wg.Add(1)
+	go w.runMill()
+	// Process the rotated log files left behind by previous runs.
+	w.triggerMill()
+
+	if len(o.signals) > 0 {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, o.signals...)
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			defer signal.Stop(sigs)
+			for {
+				select {
+				case <-sigs:
+					_ = w.Reopen()
+				case <-w.done:
+					return
+				}
+			}
+		}()
+	}
+	return w, nil
+}
+
+// Write implements io.Writer, rotating the log file first if writing p would
+// exceed the maximum size or the rotation interval has passed.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.ensureOpen(); err != nil {
+		return 0, err
+	}
+	if w.shouldRotate(int64(len(p))) {
+		// if the rotation fails, keep writing to the current log file so no
+		// log lines are lost; rotation is retried on the next write
+		if err := w.rotate(); err != nil && w.file == nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// shouldRotate returns whether the log file must be rotated before writing n
+// bytes. An empty log file is never rotated by size, so writes larger than the
+// maximum size still succeed.
+func (w *Writer) shouldRotate(n int64) bool {
+	if w.maxSize > 0 && w.size > 0 && w.size+n > w.maxSize {
+		return true
+	}
+	return w.interval > 0 && w.now().Sub(w.openedAt) >= w.interval
+}
+
+// Rotate rotates the log file, regardless of its size and age.
+func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.ensureOpen(); err != nil {
+		return err
+	}
+	return w.rotate()
+}
+
+// Reopen closes and reopens the log file, so writes go to a new log file if
+// the current one has been moved away.
+func (w *Writer) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return ErrClosed
+	}
+	if w.file != nil {
+		err := w.file.Close()
+		w.file = nil
+		if err != nil {
+			return err
+		}
+	}
+	return w.open()
+}
+
+// Close closes the log file and waits for the background processing of
+// rotated log files to finish.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	var err error
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	w.closed = true
+	close(w.done)
+	close(w.mill)
+	w.mu.Unlock()
+
+	w.wg.Wait()
+	return err
+}
+
+// ensureOpen returns ErrClosed if the Writer is closed and otherwise opens the
+// log file if a previous rotation or reopen failed to do so.
+func (w *Writer) ensureOpen() error {
+	if w.closed {
+		return ErrClosed
+	}
+	if w.file == nil {
+		return w.open()
+	}
+	return nil
+}
+
+// open opens the log file for appending.
+func (w *Writer) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.filename), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	w.file, w.size, w.openedAt = f, fi.Size(), w.now()
+	return nil
+}
+
+// rotate renames the current log file to a backup name and opens a new one.
+// If renaming fails, the current log file is reopened. If opening fails, the
+// Writer is left without log file until the next attempt to open it succeeds.
+func (w *Writer) rotate() error {
+	err := w.file.Close()
+	w.file = nil
+	if err != nil {
+		return err
+	}
+	t := w.now()
+	name := w.backupName(t)
+	for exists(name) || exists(name+compressSuffix) {
+		t = t.Add(time.Millisecond)
+		name = w.backupName(t)
+	}
+	if err := w.rename(w.filename, name); err != nil && !os.IsNotExist(err) {
+		if openErr := w.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.triggerMill()
+	return nil
+}
+
+// backupName returns the name of the log file rotated at the given time.
+func (w *Writer) backupName(t time.Time) string {
+	prefix, ext := w.prefixAndExt()
+	return prefix + t.UTC().Format(backupTimeFormat) + ext
+}
+
+// prefixAndExt returns the parts of rotated log file names around the
+// timestamp.
+func (w *Writer) prefixAndExt() (prefix, ext string) {
+	ext = filepath.Ext(w.filename)
+	return strings.TrimSuffix(w.filename, ext) + "-", ext
+}
+
+// triggerMill schedules the processing of rotated log files, unless already
+// scheduled.
+func (w *Writer) triggerMill() {
+	select {
+	case w.mill <- struct{}{}:
+	default:
+	}
+}
+
+// runMill processes rotated log files each time it's triggered, until the
+// Writer is closed.
+func (w *Writer) runMill() {
+	defer w.wg.Done()
+	for range w.mill {
+		w.millOnce()
+	}
+}
+
+// backup is a rotated log file.
+type backup struct {
+	name      string
+	rotatedAt time.Time
+}
+
+// millOnce removes the rotated log files exceeding the retention settings and
+// compresses the remaining ones if enabled.
+func (w *Writer) millOnce() {
+	backups := w.backups()
+	// backups are sorted newest first
+	var remove []backup
+	if w.maxBackups > 0 && len(backups) > w.maxBackups {
+		remove = append(remove, backups[w.maxBackups:]...)
+		backups = backups[:w.maxBackups]
+	}
+	if w.maxAge > 0 {
+		cutoff := w.now().Add(-w.maxAge)
+		for i, b := range backups {
+			if b.rotatedAt.Before(cutoff) {
+				remove = append(remove, backups[i:]...)
+				backups = backups[:i]
+				break
+			}
+		}
+	}
+	for _, b := range remove {
+		_ = os.Remove(b.name)
+	}
+	if !w.compress {
+		return
+	}
+	for _, b := range backups {
+		if !strings.HasSuffix(b.name, compressSuffix) {
+			_ = compressFile(b.name)
+		}
+	}
+}
+
+// backups returns the rotated log files sorted by rotation time, newest first.
+func (w *Writer) backups() []backup {
+	prefix, ext := w.prefixAndExt()
+	entries, err := os.ReadDir(filepath.Dir(w.filename))
+	if err != nil {
+		return nil
+	}
+	base := filepath.Base(prefix)
+	var backups []backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, base) {
+			continue
+		}
+		ts := strings.TrimPrefix(name, base)
+		ts = strings.TrimSuffix(ts, compressSuffix)
+		if !strings.HasSuffix(ts, ext) {
+			continue
+		}
+		t, err := time.Parse(backupTimeFormat, strings.TrimSuffix(ts, ext))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{name: filepath.Join(filepath.Dir(w.filename), name), rotatedAt: t})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].rotatedAt.After(backups[j].rotatedAt) })
+	return backups
+}
+
+// compressFile gzip-compresses the named file, removing it on success.
+func compressFile(name string) (err error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	dst, err := os.OpenFile(name+compressSuffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(name + compressSuffix)
+		}
+	}()
+
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// exists returns whether the named file exists.
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
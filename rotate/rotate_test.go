@@ -0,0 +1,360 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rotate
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock advancing only when told to.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func newClock() *fakeClock {
+	return &fakeClock{t: time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)}
+}
+
+func withClock(c *fakeClock) Option {
+	return func(o *options) {
+		o.now = c.now
+	}
+}
+
+func TestRotate(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []Option
+		write func(w *Writer, c *fakeClock)
+		want  map[string]string
+	}{
+		{
+			"size",
+			[]Option{WithMaxSize(10)},
+			func(w *Writer, c *fakeClock) {
+				write(t, w, "12345\n")
+				write(t, w, "6789\n")
+				c.advance(time.Second)
+				write(t, w, "abc\n")
+			},
+			map[string]string{
+				"app.log":                         "6789\nabc\n",
+				"app-2023-01-02T03-04-05.000.log": "12345\n",
+			},
+		},
+		{
+			"large write",
+			[]Option{WithMaxSize(2)},
+			func(w *Writer, c *fakeClock) { write(t, w, "12345\n") },
+			map[string]string{"app.log": "12345\n"},
+		},
+		{
+			"interval",
+			[]Option{WithMaxSize(0), WithInterval(time.Hour)},
+			func(w *Writer, c *fakeClock) {
+				write(t, w, "first\n")
+				c.advance(time.Hour)
+				write(t, w, "second\n")
+			},
+			map[string]string{
+				"app.log":                         "second\n",
+				"app-2023-01-02T04-04-05.000.log": "first\n",
+			},
+		},
+		{
+			"max backups",
+			[]Option{WithMaxBackups(2)},
+			func(w *Writer, c *fakeClock) {
+				for _, s := range []string{"1\n", "2\n", "3\n", "4\n"} {
+					write(t, w, s)
+					c.advance(time.Second)
+					rotate(t, w)
+				}
+			},
+			map[string]string{
+				"app.log":                         "",
+				"app-2023-01-02T03-04-08.000.log": "3\n",
+				"app-2023-01-02T03-04-09.000.log": "4\n",
+			},
+		},
+		{
+			"max age",
+			[]Option{WithMaxAge(time.Minute)},
+			func(w *Writer, c *fakeClock) {
+				write(t, w, "old\n")
+				rotate(t, w)
+				c.advance(time.Hour)
+				write(t, w, "new\n")
+				rotate(t, w)
+			},
+			map[string]string{
+				"app.log":                         "",
+				"app-2023-01-02T04-04-05.000.log": "new\n",
+			},
+		},
+		{
+			"same time",
+			nil,
+			func(w *Writer, c *fakeClock) {
+				write(t, w, "1\n")
+				rotate(t, w)
+				write(t, w, "2\n")
+				rotate(t, w)
+			},
+			map[string]string{
+				"app.log":                         "",
+				"app-2023-01-02T03-04-05.000.log": "1\n",
+				"app-2023-01-02T03-04-05.001.log": "2\n",
+			},
+		},
+		{
+			"compress",
+			[]Option{WithCompress()},
+			func(w *Writer, c *fakeClock) {
+				write(t, w, "rotated\n")
+				rotate(t, w)
+				write(t, w, "current\n")
+			},
+			map[string]string{
+				"app.log":                            "current\n",
+				"app-2023-01-02T03-04-05.000.log.gz": "rotated\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			c := newClock()
+			w, err := New(filepath.Join(dir, "app.log"), append(tt.opts, withClock(c))...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			tt.write(w, c)
+			if err := w.Close(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			have := readDir(t, dir)
+			if len(have) != len(tt.want) {
+				t.Fatalf("files=%v, want: %v", keys(have), keys(tt.want))
+			}
+			for name, content := range tt.want {
+				if have[name] != content {
+					t.Fatalf("%s=%q, want: %q", name, have[name], content)
+				}
+			}
+		})
+	}
+}
+
+func TestExistingBackups(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"app-2023-01-01T00-00-00.000.log", "app-2023-01-01T00-00-01.000.log", "app-other.log"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	w, err := New(filepath.Join(dir, "app.log"), WithMaxBackups(1), withClock(newClock()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"app-2023-01-01T00-00-01.000.log", "app-other.log", "app.log"}
+	if have := keys(readDir(t, dir)); strings.Join(have, ",") != strings.Join(want, ",") {
+		t.Fatalf("files=%v, want: %v", have, want)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	w, err := New(name, WithReopenOnSignal(syscall.SIGHUP))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = w.Close() }()
+
+	write(t, w, "first\n")
+	// emulate logrotate moving the log file away
+	if err = os.Rename(name, name+".1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = p.Signal(syscall.SIGHUP); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !exists(name) {
+		if time.Now().After(deadline) {
+			t.Fatalf("log file not reopened")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	write(t, w, "second\n")
+
+	have := readDir(t, dir)
+	if have["app.log"] != "second\n" || have["app.log.1"] != "first\n" {
+		t.Fatalf("files=%v, want: app.log=second, app.log.1=first", have)
+	}
+}
+
+func TestRotateFailure(t *testing.T) {
+	errRename := errors.New("rename failed")
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+
+	var rename func(oldpath, newpath string) error
+	w, err := New(name, withClock(newClock()), func(o *options) {
+		o.rename = func(oldpath, newpath string) error { return rename(oldpath, newpath) }
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = w.Close() }()
+
+	// renaming fails: writes go on to the current log file
+	rename = func(string, string) error { return errRename }
+	write(t, w, "first\n")
+	if err = w.Rotate(); err != errRename {
+		t.Fatalf("Rotate()=%v, want: %v", err, errRename)
+	}
+	write(t, w, "second\n")
+	if have := readDir(t, dir); len(have) != 1 || have["app.log"] != "first\nsecond\n" {
+		t.Fatalf("files=%v, want: app.log=first,second", have)
+	}
+
+	// reopening fails: writes fail until the log file can be opened again
+	rename = func(oldpath, newpath string) error {
+		if err := os.Rename(oldpath, newpath); err != nil {
+			return err
+		}
+		return os.Mkdir(oldpath, 0o755)
+	}
+	if err = w.Rotate(); err == nil {
+		t.Fatalf("Rotate()=nil, want: error")
+	}
+	if _, err = w.Write([]byte("lost\n")); err == nil {
+		t.Fatalf("Write()=nil, want: error")
+	}
+	if err = os.Remove(name); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	write(t, w, "third\n")
+	if have := readDir(t, dir); have["app.log"] != "third\n" || have["app-2023-01-02T03-04-05.000.log"] != "first\nsecond\n" {
+		t.Fatalf("files=%v, want: app.log=third, backup=first,second", have)
+	}
+}
+
+func TestClosed(t *testing.T) {
+	w, err := New(filepath.Join(t.TempDir(), "app.log"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = w.Write([]byte("text")); err != ErrClosed {
+		t.Fatalf("Write()=%v, want: %v", err, ErrClosed)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close()=%v, want: nil", err)
+	}
+}
+
+func write(t *testing.T, w *Writer, s string) {
+	t.Helper()
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func rotate(t *testing.T, w *Writer) {
+	t.Helper()
+	if err := w.Rotate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// readDir returns the contents of the files in dir, decompressing gzipped
+// files.
+func readDir(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	files := make(map[string]string)
+	for _, e := range entries {
+		f, err := os.Open(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var r io.Reader = f
+		if strings.HasSuffix(e.Name(), compressSuffix) {
+			if r, err = gzip.NewReader(f); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		b, err := io.ReadAll(r)
+		_ = f.Close()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		files[e.Name()] = string(b)
+	}
+	return files
+}
+
+func keys(m map[string]string) []string {
+	var k []string
+	for key := range m {
+		k = append(k, key)
+	}
+	sort.Strings(k)
+	return k
+}
@@ -0,0 +1,313 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sampling provides a telemetry.Logger decorator sampling log lines
+// per message to protect against log floods from hot code paths.
+package sampling
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+// Defaults used for the sampling policy.
+const (
+	DefaultInterval   = time.Second
+	DefaultFirst      = 100
+	DefaultThereafter = 100
+)
+
+// DroppedMessage is the message of the summary log line written for sampled
+// messages that were dropped in a previous interval. The summary holds the
+// sampled message and the number of dropped log lines as key-value pairs.
+const DroppedMessage = "dropped similar messages"
+
+// Option implements a functional option type for the sampling Logger.
+type Option func(*options)
+
+type options struct {
+	interval   time.Duration
+	first      int
+	thereafter int
+	now        func() time.Time
+}
+
+// WithInterval sets the interval after which the sampling counters of a
+// message are reset.
+func WithInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.interval = interval
+	}
+}
+
+// WithFirst sets the number of log lines per message and interval that are
+// always written.
+func WithFirst(n int) Option {
+	return func(o *options) {
+		o.first = n
+	}
+}
+
+// WithThereafter sets the sampling rate once the first log lines of a message
+// have been written within an interval: every Mth log line is written. If m is
+// zero or less, all log lines after the first ones are dropped.
+func WithThereafter(m int) Option {
+	return func(o *options) {
+		o.thereafter = m
+	}
+}
+
+// counter holds the sampling state of a single message.
+type counter struct {
+	start   time.Time
+	count   int
+	dropped int
+}
+
+// sampler holds the sampling state shared by all Loggers derived from the
+// same root Logger.
+type sampler struct {
+	options
+	mu       sync.Mutex
+	counters map[key]*counter
+	// swept holds the last time expired counters were removed.
+	swept time.Time
+}
+
+// key identifies the log lines subject to sampling.
+type key struct {
+	level telemetry.Level
+	msg   string
+}
+
+// summary holds the number of dropped log lines of a message still to be
+// reported.
+type summary struct {
+	key
+	dropped int
+}
+
+// sample returns whether the log line should be written and the summaries of
+// the messages which had log lines dropped in an interval that has since
+// expired. Once per interval the counters of all expired messages are
+// removed, so messages which don't recur neither hold memory nor lose their
+// summary.
+func (s *sampler) sample(level telemetry.Level, msg string) (write bool, summaries []summary) {
+	now := s.now()
+	k := key{level: level, msg: msg}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.swept) >= s.interval {
+		summaries = s.sweep(k, now)
+	}
+
+	c, ok := s.counters[k]
+	if !ok {
+		c = &counter{start: now}
+		s.counters[k] = c
+	}
+	if now.Sub(c.start) >= s.interval {
+		if c.dropped > 0 {
+			summaries = append(summaries, summary{key: k, dropped: c.dropped})
+		}
+		*c = counter{start: now}
+	}
+
+	c.count++
+	n := c.count - s.first
+	if n <= 0 || (s.thereafter > 0 && n%s.thereafter == 0) {
+		return true, summaries
+	}
+	c.dropped++
+	return false, summaries
+}
+
+// sweep removes the expired counters other than the one of the current
+// message and returns the summaries of the ones which had log lines dropped,
+// sorted by level and message.
+func (s *sampler) sweep(current key, now time.Time) []summary {
+	s.swept = now
+	var summaries []summary
+	for k, c := range s.counters {
+		if k == current || now.Sub(c.start) < s.interval {
+			continue
+		}
+		if c.dropped > 0 {
+			summaries = append(summaries, summary{key: k, dropped: c.dropped})
+		}
+		delete(s.counters, k)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].level != summaries[j].level {
+			return summaries[i].level < summaries[j].level
+		}
+		return summaries[i].msg < summaries[j].msg
+	})
+	return summaries
+}
+
+// Logger is a telemetry.Logger sampling the log lines written to the wrapped
+// Logger.
+type Logger struct {
+	// logger holds the wrapped Logger, never having a Metric attached as the
+	// Metric is recorded by this Logger for each call.
+	logger telemetry.Logger
+	// ctx holds the Context used to record the Metric.
+	ctx context.Context
+	// metric holds the Metric to increment each time Info() or Error() is called.
+	metric  telemetry.Metric
+	sampler *sampler
+}
+
+// compile time check for compatibility with the telemetry.Logger and
+// telemetry.CallerSkipper interfaces.
+var (
+	_ telemetry.Logger        = (*Logger)(nil)
+	_ telemetry.CallerSkipper = (*Logger)(nil)
+)
+
+// New returns a Logger sampling the log lines written to the provided Logger.
+// Sampling is done per level and message: within each interval the first N log
+// lines are written, after which only every Mth log line is written. Once the
+// interval of a message which had log lines dropped expires, a summary line
+// with DroppedMessage is written at the same level before the next log line of
+// any message.
+//
+// Levels are shared with the wrapped Logger. Attached Metrics are recorded for
+// every Info and Error call, including the ones for dropped log lines, so
+// metrics stay accurate.
+func New(logger telemetry.Logger, opts ...Option) telemetry.Logger {
+	o := options{
+		interval:   DefaultInterval,
+		first:      DefaultFirst,
+		thereafter: DefaultThereafter,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Logger{
+		logger:  telemetry.AddCallerSkip(logger, 1),
+		ctx:     context.Background(),
+		sampler: &sampler{options: o, counters: make(map[key]*counter)},
+	}
+}
+
+// Debug emits a sampled log message at debug level.
+func (l *Logger) Debug(msg string, keyValues ...interface{}) {
+	write, summaries := l.sample(telemetry.LevelDebug, msg)
+	l.report(summaries)
+	if write {
+		l.logger.Debug(msg, keyValues...)
+	}
+}
+
+// Info emits a sampled log message at info level.
+func (l *Logger) Info(msg string, keyValues ...interface{}) {
+	l.record()
+	write, summaries := l.sample(telemetry.LevelInfo, msg)
+	l.report(summaries)
+	if write {
+		l.logger.Info(msg, keyValues...)
+	}
+}
+
+// Error emits a sampled log message at error level.
+func (l *Logger) Error(msg string, err error, keyValues ...interface{}) {
+	l.record()
+	write, summaries := l.sample(telemetry.LevelError, msg)
+	l.report(summaries)
+	if write {
+		l.logger.Error(msg, err, keyValues...)
+	}
+}
+
+// sample returns whether a log line at the given level should be written.
+// Log lines disabled by the configured level don't count towards sampling.
+func (l *Logger) sample(level telemetry.Level, msg string) (bool, []summary) {
+	if level > l.logger.Level() {
+		return false, nil
+	}
+	return l.sampler.sample(level, msg)
+}
+
+// report writes a DroppedMessage summary line for each of the provided
+// summaries at the level of the dropped log lines.
+func (l *Logger) report(summaries []summary) {
+	for _, s := range summaries {
+		switch s.level {
+		case telemetry.LevelError:
+			l.logger.Error(DroppedMessage, nil, "message", s.msg, "dropped", s.dropped)
+		case telemetry.LevelInfo:
+			l.logger.Info(DroppedMessage, "message", s.msg, "dropped", s.dropped)
+		default:
+			l.logger.Debug(DroppedMessage, "message", s.msg, "dropped", s.dropped)
+		}
+	}
+}
+
+// record records the attached Metric, if any.
+func (l *Logger) record() {
+	if l.metric != nil {
+		l.metric.RecordContext(l.ctx, 1)
+	}
+}
+
+// AddCallerSkip implements telemetry.CallerSkipper.
+func (l *Logger) AddCallerSkip(skip int) telemetry.Logger {
+	return &Logger{logger: telemetry.AddCallerSkip(l.logger, skip), ctx: l.ctx, metric: l.metric, sampler: l.sampler}
+}
+
+// Level returns the logging level of the wrapped Logger.
+func (l *Logger) Level() telemetry.Level { return l.logger.Level() }
+
+// SetLevel configures the logging level of the wrapped Logger.
+func (l *Logger) SetLevel(level telemetry.Level) { l.logger.SetLevel(level) }
+
+// With returns Logger with provided key value pairs attached.
+func (l *Logger) With(keyValues ...interface{}) telemetry.Logger {
+	if len(keyValues) == 0 {
+		return l
+	}
+	return &Logger{logger: l.logger.With(keyValues...), ctx: l.ctx, metric: l.metric, sampler: l.sampler}
+}
+
+// Context attaches provided Context to the Logger allowing metadata found in
+// this context to be used for log lines and metrics labels.
+func (l *Logger) Context(ctx context.Context) telemetry.Logger {
+	return &Logger{logger: l.logger.Context(ctx), ctx: ctx, metric: l.metric, sampler: l.sampler}
+}
+
+// Metric attaches provided Metric to the Logger allowing this metric to
+// record each invocation of Info and Error log lines, sampled or not.
+func (l *Logger) Metric(m telemetry.Metric) telemetry.Logger {
+	return &Logger{logger: l.logger, ctx: l.ctx, metric: m, sampler: l.sampler}
+}
+
+// Clone the current Logger and return it. The clone has its own level and
+// sampling state.
+func (l *Logger) Clone() telemetry.Logger {
+	return &Logger{
+		logger:  l.logger.Clone(),
+		ctx:     l.ctx,
+		metric:  l.metric,
+		sampler: &sampler{options: l.sampler.options, counters: make(map[key]*counter)},
+	}
+}
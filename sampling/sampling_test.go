@@ -0,0 +1,195 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sampling
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/function"
+)
+
+func TestSampling(t *testing.T) {
+	tests := []struct {
+		name       string
+		level      telemetry.Level
+		first      int
+		thereafter int
+		calls      int
+		logfunc    func(telemetry.Logger, int)
+		expected   []string
+		metric     float64
+	}{
+		{"first", telemetry.LevelInfo, 2, 0, 4, func(l telemetry.Logger, i int) { l.Info("text", "i", i) },
+			[]string{`level=info msg="text" [ctx value i 0]`, `level=info msg="text" [ctx value i 1]`}, 4},
+		{"thereafter", telemetry.LevelInfo, 1, 2, 6, func(l telemetry.Logger, i int) { l.Info("text", "i", i) },
+			[]string{`level=info msg="text" [ctx value i 0]`, `level=info msg="text" [ctx value i 2]`, `level=info msg="text" [ctx value i 4]`}, 6},
+		{"per-message", telemetry.LevelInfo, 1, 0, 4, func(l telemetry.Logger, i int) { l.Info(fmt.Sprintf("text%d", i%2)) },
+			[]string{`level=info msg="text0" [ctx value]`, `level=info msg="text1" [ctx value]`}, 4},
+		{"per-level", telemetry.LevelDebug, 1, 0, 4, func(l telemetry.Logger, i int) {
+			if i%2 == 0 {
+				l.Debug("text")
+			} else {
+				l.Error("text", errors.New("error"))
+			}
+		}, []string{`level=debug msg="text" [ctx value]`, `level=error msg="text" err=error [ctx value]`}, 2},
+		{"disabled-level", telemetry.LevelError, 1, 0, 3, func(l telemetry.Logger, i int) {
+			if i < 2 {
+				l.Info("text")
+			} else {
+				l.Error("text", errors.New("error"))
+			}
+		}, []string{`level=error msg="text" err=error [ctx value]`}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			inner := function.NewLogger(emitter(&out))
+			inner.SetLevel(tt.level)
+
+			metric := mockMetric{}
+			ctx := telemetry.KeyValuesToContext(context.Background(), "ctx", "value")
+			l := New(inner, WithFirst(tt.first), WithThereafter(tt.thereafter)).Context(ctx).Metric(&metric)
+
+			for i := 0; i < tt.calls; i++ {
+				tt.logfunc(l, i)
+			}
+
+			if lines := lines(&out); strings.Join(lines, "\n") != strings.Join(tt.expected, "\n") {
+				t.Fatalf("lines=%q, want: %q", lines, tt.expected)
+			}
+			if metric.count != tt.metric {
+				t.Fatalf("metric.count=%v, want: %v", metric.count, tt.metric)
+			}
+		})
+	}
+}
+
+func TestSamplingInterval(t *testing.T) {
+	var (
+		out bytes.Buffer
+		now = time.Unix(0, 0)
+	)
+	clock := func(o *options) { o.now = func() time.Time { return now } }
+	l := New(function.NewLogger(emitter(&out)), WithInterval(time.Second), WithFirst(1), WithThereafter(0), clock).
+		With("key", "value")
+
+	for i := 0; i < 4; i++ {
+		l.Info("text", "i", i)
+	}
+	now = now.Add(time.Second)
+	l.Info("text", "i", 4)
+	l.Info("text", "i", 5)
+	now = now.Add(time.Second)
+	l.Info("text", "i", 6)
+
+	expected := []string{
+		`level=info msg="text" [key value i 0]`,
+		`level=info msg="dropped similar messages" [key value message text dropped 3]`,
+		`level=info msg="text" [key value i 4]`,
+		`level=info msg="dropped similar messages" [key value message text dropped 1]`,
+		`level=info msg="text" [key value i 6]`,
+	}
+	if lines := lines(&out); strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("lines=%q, want: %q", lines, expected)
+	}
+}
+
+func TestSamplingExpired(t *testing.T) {
+	var out bytes.Buffer
+	now := time.Now()
+	l := New(function.NewLogger(emitter(&out)), WithFirst(1), WithThereafter(0), WithInterval(time.Second),
+		func(o *options) { o.now = func() time.Time { return now } })
+
+	for i := 0; i < 3; i++ {
+		l.Info("burst")
+	}
+	l.Error("other", nil)
+	now = now.Add(time.Second)
+	l.Info("next")
+
+	expected := []string{
+		`level=info msg="burst" []`,
+		`level=error msg="other" []`,
+		`level=info msg="dropped similar messages" [message burst dropped 2]`,
+		`level=info msg="next" []`,
+	}
+	if lines := lines(&out); strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("lines=%q, want: %q", lines, expected)
+	}
+	if n := len(l.(*Logger).sampler.counters); n != 1 {
+		t.Fatalf("counters=%d, want: 1", n)
+	}
+}
+
+func TestSharedLevelAndState(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(function.NewLogger(emitter(&out)), WithFirst(1), WithThereafter(0))
+	derived := logger.With("key", "value").Context(context.Background())
+
+	logger.SetLevel(telemetry.LevelDebug)
+	if derived.Level() != telemetry.LevelDebug {
+		t.Fatalf("derived.Level()=%v, want: %v", derived.Level(), telemetry.LevelDebug)
+	}
+
+	logger.Info("text")
+	derived.Info("text")
+	if lines := lines(&out); len(lines) != 1 {
+		t.Fatalf("expected sampling state to be shared, got %q", lines)
+	}
+
+	clone := logger.Clone()
+	clone.SetLevel(telemetry.LevelError)
+	if logger.Level() != telemetry.LevelDebug {
+		t.Fatalf("logger.Level()=%v, want: %v", logger.Level(), telemetry.LevelDebug)
+	}
+	clone.Error("text", nil)
+	clone.Error("text", nil)
+	if lines := lines(&out); len(lines) != 2 {
+		t.Fatalf("expected clone to have its own sampling state, got %q", lines)
+	}
+}
+
+func lines(out *bytes.Buffer) []string {
+	return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+}
+
+func emitter(w io.Writer) function.Emit {
+	return func(level telemetry.Level, msg string, err error, values function.Values) {
+		_, _ = fmt.Fprintf(w, "level=%v msg=%q", level, msg)
+		if err != nil {
+			_, _ = fmt.Fprintf(w, " err=%v", err)
+		}
+
+		all := append(values.FromContext, values.FromLogger...)
+		all = append(all, values.FromMethod...)
+		_, _ = fmt.Fprintf(w, " %v\n", all)
+	}
+}
+
+type mockMetric struct {
+	telemetry.Metric
+	count float64
+}
+
+func (m *mockMetric) RecordContext(_ context.Context, value float64) { m.count += value }
@@ -28,7 +28,8 @@ import (
 )
 
 var (
-	_ telemetry.Logger = (*scope)(nil)
+	_ telemetry.Logger        = (*scope)(nil)
+	_ telemetry.CallerSkipper = (*scope)(nil)
 
 	lock          = sync.Mutex{}
 	scopes        = make(map[string]*scope)
@@ -60,7 +61,14 @@ var _ Scope = (*scope)(nil)
 
 // scope provides scoped logging functionality.
 type scope struct {
-	logger      telemetry.Logger
+	logger telemetry.Logger
+	// skipped holds logger skipping the stack frame of the scope's logging
+	// methods, so call sites captured by the logger are the ones of the
+	// scope's callers.
+	skipped telemetry.Logger
+	// skip holds the number of additional stack frames to skip, applied to
+	// the logger once set by UseLogger.
+	skip        int
 	kvs         []interface{}
 	ctx         context.Context
 	metric      telemetry.Metric
@@ -82,7 +90,7 @@ func (s *scope) Description() string {
 // Debug implements telemetry.Logger.
 func (s *scope) Debug(msg string, keyValuePairs ...interface{}) {
 	if s.logger != nil {
-		s.logger.Debug(msg, keyValuePairs...)
+		s.skipped.Debug(msg, keyValuePairs...)
 	}
 	if PanicOnUninitialized {
 		panic("calling Debug on uninitialized logger")
@@ -92,7 +100,7 @@ func (s *scope) Debug(msg string, keyValuePairs ...interface{}) {
 // Info implements telemetry.Logger.
 func (s *scope) Info(msg string, keyValuePairs ...interface{}) {
 	if s.logger != nil {
-		s.logger.Info(msg, keyValuePairs...)
+		s.skipped.Info(msg, keyValuePairs...)
 	}
 	if PanicOnUninitialized {
 		panic("calling Info on uninitialized logger")
@@ -102,7 +110,7 @@ func (s *scope) Info(msg string, keyValuePairs ...interface{}) {
 // Error implements telemetry.Logger.
 func (s *scope) Error(msg string, err error, keyValuePairs ...interface{}) {
 	if s.logger != nil {
-		s.logger.Error(msg, err, keyValuePairs...)
+		s.skipped.Error(msg, err, keyValuePairs...)
 	}
 	if PanicOnUninitialized {
 		panic("calling Error on uninitialized logger")
@@ -118,11 +126,12 @@ func (s *scope) With(keyValuePairs ...interface{}) telemetry.Logger {
 		keyValuePairs = append(keyValuePairs, "(MISSING)")
 	}
 	if s.logger != nil {
-		return s.logger.With(keyValuePairs...)
+		return s.withSkip(s.logger.With(keyValuePairs...))
 	}
 	sc := &scope{
 		name:        s.name,
 		description: s.description,
+		skip:        s.skip,
 		kvs:         make([]interface{}, len(s.kvs), len(s.kvs)+len(keyValuePairs)),
 		ctx:         s.ctx,
 		metric:      s.metric,
@@ -144,7 +153,7 @@ func (s *scope) With(keyValuePairs ...interface{}) telemetry.Logger {
 // Context implements telemetry.Logger.
 func (s *scope) Context(ctx context.Context) telemetry.Logger {
 	if s.logger != nil {
-		return s.logger.Context(ctx)
+		return s.withSkip(s.logger.Context(ctx))
 	}
 
 	sc := s.Clone()
@@ -158,7 +167,7 @@ func (s *scope) Context(ctx context.Context) telemetry.Logger {
 // Metric implements telemetry.Logger.
 func (s *scope) Metric(m telemetry.Metric) telemetry.Logger {
 	if s.logger != nil {
-		return s.logger.Metric(m)
+		return s.withSkip(s.logger.Metric(m))
 	}
 
 	sc := s.Clone()
@@ -178,6 +187,8 @@ func (s *scope) Clone() telemetry.Logger {
 
 	scope := &scope{
 		logger:      logger,
+		skipped:     telemetry.AddCallerSkip(logger, 1+s.skip),
+		skip:        s.skip,
 		name:        s.name,
 		description: s.description,
 		kvs:         make([]interface{}, len(s.kvs)),
@@ -191,6 +202,43 @@ func (s *scope) Clone() telemetry.Logger {
 	return scope
 }
 
+// AddCallerSkip implements telemetry.CallerSkipper. The returned scope shares
+// the logger and level of s. For scopes without a logger yet, the skip is
+// applied once UseLogger is called.
+func (s *scope) AddCallerSkip(skip int) telemetry.Logger {
+	if skip == 0 {
+		return s
+	}
+	sc := &scope{
+		logger:      s.logger,
+		skip:        s.skip + skip,
+		name:        s.name,
+		description: s.description,
+		level:       s.level,
+	}
+	if s.logger != nil {
+		sc.skipped = telemetry.AddCallerSkip(s.logger, 1+sc.skip)
+		return sc
+	}
+
+	sc.kvs = make([]interface{}, len(s.kvs))
+	copy(sc.kvs, s.kvs)
+	sc.ctx = s.ctx
+	sc.metric = s.metric
+	lock.Lock()
+	uninitialized[s.name] = append(uninitialized[s.name], sc)
+	lock.Unlock()
+	return sc
+}
+
+// withSkip returns the logger skipping the additional stack frames of s.
+func (s *scope) withSkip(logger telemetry.Logger) telemetry.Logger {
+	if s.skip == 0 {
+		return logger
+	}
+	return telemetry.AddCallerSkip(logger, s.skip)
+}
+
 // SetLevel implements level.Logger.
 func (s *scope) SetLevel(lvl telemetry.Level) {
 	if s.logger != nil {
@@ -241,7 +289,9 @@ func Register(name, description string) Scope {
 			level:       &level,
 		}
 		if defaultLogger != nil {
-			sc.logger = defaultLogger.Clone().With(Key, name)
+			l := defaultLogger.Clone().With(Key, name)
+			sc.skipped = telemetry.AddCallerSkip(l, 1)
+			sc.logger = l
 		}
 
 		scopes[name] = sc
@@ -393,6 +443,7 @@ func UseLogger(logger telemetry.Logger) {
 			}
 			l.SetLevel(sc.Level())
 
+			sc.skipped = telemetry.AddCallerSkip(l, 1+sc.skip)
 			sc.logger = l
 			sc.kvs = nil
 			sc.ctx = nil
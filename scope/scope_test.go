@@ -20,12 +20,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"reflect"
+	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 
 	"github.com/tetratelabs/telemetry"
 	"github.com/tetratelabs/telemetry/function"
+	"github.com/tetratelabs/telemetry/sampling"
 )
 
 func TestParallel(t *testing.T) {
@@ -173,6 +177,88 @@ func TestFind(t *testing.T) {
 	}
 }
 
+func TestCaller(t *testing.T) {
+	cleanup()
+	t.Cleanup(cleanup)
+
+	var lines []int
+	early := Register("caller-early", "registered before UseLogger")
+	early.SetLevel(telemetry.LevelInfo)
+	UseLogger(sampling.New(function.NewLogger(func(_ telemetry.Level, _ string, _ error, values function.Values) {
+		if values.Caller == nil || !strings.HasSuffix(values.Caller.File, "scope/scope_test.go") {
+			t.Errorf("unexpected caller %+v", values.Caller)
+			return
+		}
+		lines = append(lines, values.Caller.Line)
+	}, function.WithCaller())))
+	late := Register("caller-late", "registered after UseLogger")
+
+	var want []int
+	early.Info("text")
+	want = append(want, line())
+	late.Error("text", nil)
+	want = append(want, line())
+	late.With("key", "value").Info("text")
+	want = append(want, line())
+	early.Context(context.Background()).Info("text")
+	want = append(want, line())
+	early.Clone().Info("text")
+	want = append(want, line())
+
+	if !reflect.DeepEqual(lines, want) {
+		t.Fatalf("lines=%v, want: %v", lines, want)
+	}
+}
+
+func TestAddCallerSkip(t *testing.T) {
+	cleanup()
+	t.Cleanup(cleanup)
+
+	var lines []int
+	early := Register("skip-early", "registered before UseLogger")
+	early.SetLevel(telemetry.LevelInfo)
+	earlySkip := telemetry.AddCallerSkip(early, 1)
+	UseLogger(function.NewLogger(func(_ telemetry.Level, _ string, _ error, values function.Values) {
+		lines = append(lines, values.Caller.Line)
+	}, function.WithCaller()))
+	late := Register("skip-late", "registered after UseLogger")
+	late.SetLevel(telemetry.LevelInfo)
+	lateSkip := telemetry.AddCallerSkip(late, 1)
+
+	if _, ok := lateSkip.(Scope); !ok {
+		t.Fatalf("AddCallerSkip()=%T, want: Scope", lateSkip)
+	}
+
+	var want []int
+	logInfo(earlySkip)
+	want = append(want, line())
+	logInfo(lateSkip)
+	want = append(want, line())
+	logInfo(lateSkip.With("key", "value"))
+	want = append(want, line())
+
+	late.SetLevel(telemetry.LevelError)
+	if lateSkip.Level() != telemetry.LevelError {
+		t.Fatalf("Level()=%v, want: %v", lateSkip.Level(), telemetry.LevelError)
+	}
+	logInfo(lateSkip)
+
+	if !reflect.DeepEqual(lines, want) {
+		t.Fatalf("lines=%v, want: %v", lines, want)
+	}
+}
+
+// logInfo writes a log line on behalf of its caller.
+func logInfo(l telemetry.Logger) {
+	l.Info("text")
+}
+
+// line returns the line number preceding the one of its caller.
+func line() int {
+	_, _, l, _ := runtime.Caller(1)
+	return l - 1
+}
+
 func cleanup() {
 	scopes = make(map[string]*scope)
 	uninitialized = make(map[string][]*scope)
@@ -0,0 +1,103 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// Keys used to add the trace and span IDs found in Context to log lines.
+const (
+	TraceIDKey = "trace_id"
+	SpanIDKey  = "span_id"
+)
+
+// TraceparentHeader is the name of the W3C Trace Context header.
+const TraceparentHeader = "traceparent"
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// String returns the lowercase hex representation of the TraceID.
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+// IsValid returns true if the TraceID is not all zeros.
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// String returns the lowercase hex representation of the SpanID.
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// IsValid returns true if the SpanID is not all zeros.
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext holds the identifying trace information of a Span as defined by
+// the W3C Trace Context specification.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	TraceFlags byte
+}
+
+// IsValid returns true if the SpanContext holds a valid TraceID and SpanID.
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// IsSampled returns true if the sampled trace flag is set.
+func (sc SpanContext) IsSampled() bool { return sc.TraceFlags&0x01 == 0x01 }
+
+// Traceparent returns the W3C traceparent header value of the SpanContext.
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.TraceFlags})
+}
+
+// ErrInvalidTraceparent is returned when parsing a malformed traceparent.
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// ParseTraceparent parses a W3C traceparent header value into a SpanContext.
+func ParseTraceparent(traceparent string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || parts[0] == "ff" {
+		return sc, ErrInvalidTraceparent
+	}
+	// Version 00 has exactly four parts, future versions may append more.
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, ErrInvalidTraceparent
+	}
+	var version, flags [1]byte
+	if !decodeLowerHex(version[:], parts[0]) || !decodeLowerHex(flags[:], parts[3]) ||
+		!decodeLowerHex(sc.TraceID[:], parts[1]) || !decodeLowerHex(sc.SpanID[:], parts[2]) {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	sc.TraceFlags = flags[0]
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	return sc, nil
+}
+
+// decodeLowerHex decodes the lowercase hex string s into dst, requiring s to
+// exactly fill dst.
+func decodeLowerHex(dst []byte, s string) bool {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
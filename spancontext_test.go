@@ -0,0 +1,98 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+const (
+	traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	traceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	spanID      = "00f067aa0ba902b7"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		valid       bool
+		sampled     bool
+	}{
+		{"valid", traceparent, true, true},
+		{"not-sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"future-version", "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"empty", "", false, false},
+		{"invalid-version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"version-00-extra", traceparent + "-extra", false, false},
+		{"uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"short-trace-id", "00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01", false, false},
+		{"zero-trace-id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"zero-span-id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"non-hex", "00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tt.traceparent)
+			if (err == nil) != tt.valid {
+				t.Fatalf("ParseTraceparent(%q) err=%v, want valid: %t", tt.traceparent, err, tt.valid)
+			}
+			if sc.IsValid() != tt.valid || sc.IsSampled() != tt.sampled {
+				t.Fatalf("IsValid()=%t IsSampled()=%t, want: %t %t", sc.IsValid(), sc.IsSampled(), tt.valid, tt.sampled)
+			}
+			if tt.valid && (sc.TraceID.String() != traceID || sc.SpanID.String() != spanID) {
+				t.Fatalf("unexpected ids %s %s", sc.TraceID, sc.SpanID)
+			}
+		})
+	}
+
+	sc, _ := ParseTraceparent(traceparent)
+	if sc.Traceparent() != traceparent {
+		t.Fatalf("Traceparent()=%s, want: %s", sc.Traceparent(), traceparent)
+	}
+}
+
+func TestTraceKeyValues(t *testing.T) {
+	remote, _ := ParseTraceparent(traceparent)
+	local := SpanContext{TraceID: remote.TraceID, SpanID: SpanID{1, 2, 3, 4, 5, 6, 7, 8}}
+
+	ctx := KeyValuesToContext(context.Background(), "key", "value")
+	if have := KeyValuesFromContext(ctx); !reflect.DeepEqual(have, []interface{}{"key", "value"}) {
+		t.Fatalf("KeyValuesFromContext()=%v without span", have)
+	}
+
+	ctx = ContextWithSpanContext(ctx, remote)
+	want := []interface{}{"key", "value", TraceIDKey, traceID, SpanIDKey, spanID}
+	if have := KeyValuesFromContext(ctx); !reflect.DeepEqual(have, want) {
+		t.Fatalf("KeyValuesFromContext()=%v, want: %v", have, want)
+	}
+
+	// extracted values are not stored when adding key-value pairs
+	ctx = KeyValuesToContext(ctx, "other", "value")
+	want = []interface{}{"key", "value", "other", "value", TraceIDKey, traceID, SpanIDKey, spanID}
+	if have := KeyValuesFromContext(ctx); !reflect.DeepEqual(have, want) {
+		t.Fatalf("KeyValuesFromContext()=%v, want: %v", have, want)
+	}
+
+	// an active Span takes precedence
+	ctx = ContextWithSpan(ctx, &mockSpan{sc: local})
+	want = []interface{}{"key", "value", "other", "value", TraceIDKey, traceID, SpanIDKey, "0102030405060708"}
+	if have := KeyValuesFromContext(ctx); !reflect.DeepEqual(have, want) {
+		t.Fatalf("KeyValuesFromContext()=%v, want: %v", have, want)
+	}
+}
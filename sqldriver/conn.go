@@ -0,0 +1,184 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqldriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+)
+
+var (
+	_ driver.Conn               = (*conn)(nil)
+	_ driver.ConnPrepareContext = (*conn)(nil)
+	_ driver.ConnBeginTx        = (*conn)(nil)
+	_ driver.ExecerContext      = (*conn)(nil)
+	_ driver.QueryerContext     = (*conn)(nil)
+	_ driver.Pinger             = (*conn)(nil)
+	_ driver.SessionResetter    = (*conn)(nil)
+	_ driver.Validator          = (*conn)(nil)
+	_ driver.NamedValueChecker  = (*conn)(nil)
+)
+
+// conn implements driver.Conn and all optional interfaces, falling back to the
+// behavior database/sql applies if the wrapped connection lacks them.
+type conn struct {
+	parent driver.Conn
+	instr  *instrumentation
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (_ driver.Stmt, err error) {
+	start := c.instr.now()
+	defer func() { c.instr.observe(ctx, OpPrepare, query, start, err) }()
+
+	var s driver.Stmt
+	if p, ok := c.parent.(driver.ConnPrepareContext); ok {
+		s, err = p.PrepareContext(ctx, query)
+	} else {
+		s, err = c.parent.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{parent: s, conn: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	return c.parent.Close()
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (_ driver.Tx, err error) {
+	start := c.instr.now()
+	defer func() { c.instr.observe(ctx, OpBegin, "", start, err) }()
+
+	var t driver.Tx
+	if b, ok := c.parent.(driver.ConnBeginTx); ok {
+		t, err = b.BeginTx(ctx, opts)
+	} else {
+		if opts.Isolation != driver.IsolationLevel(0) || opts.ReadOnly {
+			return nil, errors.New("sqldriver: driver does not support non-default transaction options")
+		}
+		//nolint:staticcheck // fallback for drivers not implementing ConnBeginTx
+		t, err = c.parent.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tx{parent: t, ctx: ctx, instr: c.instr}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (_ driver.Result, err error) {
+	start := c.instr.now()
+	defer func() { c.instr.observe(ctx, OpExec, query, start, err) }()
+
+	if e, ok := c.parent.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, query, args)
+	}
+	//nolint:staticcheck // fallback for drivers not implementing ExecerContext
+	if e, ok := c.parent.(driver.Execer); ok {
+		values, verr := namedValuesToValues(args)
+		if verr != nil {
+			return nil, verr
+		}
+		return e.Exec(query, values)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (_ driver.Rows, err error) {
+	start := c.instr.now()
+	defer func() { c.instr.observe(ctx, OpQuery, query, start, err) }()
+
+	if q, ok := c.parent.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, query, args)
+	}
+	//nolint:staticcheck // fallback for drivers not implementing QueryerContext
+	if q, ok := c.parent.(driver.Queryer); ok {
+		values, verr := namedValuesToValues(args)
+		if verr != nil {
+			return nil, verr
+		}
+		return q.Query(query, values)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.parent.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.parent.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if v, ok := c.parent.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.parent.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// tx implements driver.Tx.
+type tx struct {
+	parent driver.Tx
+	ctx    context.Context
+	instr  *instrumentation
+}
+
+func (t *tx) Commit() (err error) {
+	start := t.instr.now()
+	defer func() { t.instr.observe(t.ctx, OpCommit, "", start, err) }()
+	return t.parent.Commit()
+}
+
+func (t *tx) Rollback() (err error) {
+	start := t.instr.now()
+	defer func() { t.instr.observe(t.ctx, OpRollback, "", start, err) }()
+	return t.parent.Rollback()
+}
+
+// namedValuesToValues converts named values for drivers lacking the Context
+// aware interfaces, which do not support named arguments.
+func namedValuesToValues(named []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(named))
+	for i, nv := range named {
+		if nv.Name != "" {
+			return nil, errors.New("sqldriver: driver does not support the use of Named Parameters")
+		}
+		values[i] = nv.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,218 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sqldriver provides a database/sql/driver wrapper instrumenting
+// database operations with latency and error metrics and slow query logging
+// through the telemetry facades.
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+)
+
+// Operations as found in the operation metric label.
+const (
+	OpPrepare  = "prepare"
+	OpExec     = "exec"
+	OpQuery    = "query"
+	OpBegin    = "begin"
+	OpCommit   = "commit"
+	OpRollback = "rollback"
+)
+
+// DefaultLatencyBounds holds the default histogram bounds in seconds used for
+// the operation latency distribution.
+var DefaultLatencyBounds = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+// Option implements a functional option type for the driver wrapper.
+type Option func(*options)
+
+type options struct {
+	slowThreshold time.Duration
+	redact        func(statement string) string
+	latencyBounds []float64
+	now           func() time.Time
+}
+
+// WithSlowThreshold configures the duration after which an operation is
+// considered slow and logged at Info level. Defaults to 1 second. A threshold
+// of zero disables slow operation logging.
+func WithSlowThreshold(d time.Duration) Option {
+	return func(o *options) {
+		o.slowThreshold = d
+	}
+}
+
+// WithRedaction provides a function to redact statements before they are
+// included in log lines. See RedactLiterals for a default implementation.
+func WithRedaction(redact func(statement string) string) Option {
+	return func(o *options) {
+		o.redact = redact
+	}
+}
+
+// WithLatencyBounds overrides the histogram bounds in seconds of the operation
+// latency distribution.
+func WithLatencyBounds(bounds []float64) Option {
+	return func(o *options) {
+		o.latencyBounds = bounds
+	}
+}
+
+// instrumentation holds the Logger, Metrics and configuration shared by all
+// wrapped driver objects.
+type instrumentation struct {
+	logger    telemetry.Logger
+	sink      telemetry.MetricSink
+	options   options
+	operation telemetry.Label
+	latency   telemetry.Metric
+	errors    telemetry.Metric
+}
+
+// now returns the current time of the configured clock.
+func (i *instrumentation) now() time.Time { return i.options.now() }
+
+// observe records the operation Metrics and logs slow and failed operations.
+func (i *instrumentation) observe(ctx context.Context, op, statement string, start time.Time, err error) {
+	if errors.Is(err, driver.ErrSkip) {
+		// database/sql falls back to another code path which is instrumented
+		// by itself.
+		return
+	}
+	duration := i.now().Sub(start)
+	mctx := ctx
+	if lctx, lerr := i.sink.ContextWithLabels(ctx, i.operation.Insert(op)); lerr == nil {
+		mctx = lctx
+	}
+	i.latency.RecordContext(mctx, duration.Seconds())
+
+	l := i.logger.Context(ctx)
+	keyValues := []interface{}{"operation", op, "duration", duration}
+	if statement != "" {
+		if i.options.redact != nil {
+			statement = i.options.redact(statement)
+		}
+		keyValues = append(keyValues, "statement", statement)
+	}
+	if err != nil {
+		i.errors.RecordContext(mctx, 1)
+		l.Error("sql operation failed", err, keyValues...)
+		return
+	}
+	if i.options.slowThreshold > 0 && duration >= i.options.slowThreshold {
+		l.Info("slow sql operation", keyValues...)
+	}
+}
+
+// Wrap returns a driver.Driver instrumenting the provided driver.Driver. The
+// Metrics are created on the provided MetricSink, so Wrap should be called
+// once per MetricSink.
+func Wrap(d driver.Driver, logger telemetry.Logger, sink telemetry.MetricSink, opts ...Option) driver.Driver {
+	o := options{
+		slowThreshold: time.Second,
+		latencyBounds: DefaultLatencyBounds,
+		now:           time.Now,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	i := &instrumentation{
+		logger:    logger,
+		sink:      sink,
+		options:   o,
+		operation: sink.NewLabel("operation"),
+	}
+	i.latency = sink.NewDistribution("sql_client_operation_duration_seconds",
+		"Duration of database operations",
+		o.latencyBounds,
+		telemetry.WithLabels(i.operation),
+		telemetry.WithUnit(telemetry.Seconds))
+	i.errors = sink.NewSum("sql_client_errors_total",
+		"Total number of failed database operations",
+		telemetry.WithLabels(i.operation))
+
+	wd := &wrappedDriver{parent: d, instr: i}
+	if _, ok := d.(driver.DriverContext); ok {
+		return &wrappedDriverContext{wrappedDriver: wd}
+	}
+	return wd
+}
+
+// Register wraps the driver registered as driverName and registers the result
+// with database/sql as name.
+func Register(name, driverName string, logger telemetry.Logger, sink telemetry.MetricSink, opts ...Option) error {
+	// sql.Open validates the driver name without connecting.
+	db, err := sql.Open(driverName, "")
+	if err != nil {
+		return err
+	}
+	d := db.Driver()
+	if err = db.Close(); err != nil {
+		return err
+	}
+	sql.Register(name, Wrap(d, logger, sink, opts...))
+	return nil
+}
+
+// wrappedDriver implements driver.Driver.
+type wrappedDriver struct {
+	parent driver.Driver
+	instr  *instrumentation
+}
+
+func (d *wrappedDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.parent.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{parent: c, instr: d.instr}, nil
+}
+
+// wrappedDriverContext implements driver.DriverContext for drivers supporting
+// it.
+type wrappedDriverContext struct {
+	*wrappedDriver
+}
+
+func (d *wrappedDriverContext) OpenConnector(name string) (driver.Connector, error) {
+	c, err := d.parent.(driver.DriverContext).OpenConnector(name)
+	if err != nil {
+		return nil, err
+	}
+	return &connector{parent: c, driver: d}, nil
+}
+
+// connector implements driver.Connector.
+type connector struct {
+	parent driver.Connector
+	driver *wrappedDriverContext
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	cn, err := c.parent.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{parent: cn, instr: c.driver.instr}, nil
+}
+
+func (c *connector) Driver() driver.Driver { return c.driver }
@@ -0,0 +1,268 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqldriver
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/function"
+	"github.com/tetratelabs/telemetry/metrictest"
+)
+
+func TestDriver(t *testing.T) {
+	var (
+		out  bytes.Buffer
+		sink = metrictest.NewSink(nil)
+	)
+	logger := function.NewLogger(func(level telemetry.Level, msg string, err error, values function.Values) {
+		_, _ = fmt.Fprintf(&out, "level=%v msg=%q err=%v %v\n", level, msg, err, append(values.FromContext, values.FromMethod...))
+	})
+	logger.SetLevel(telemetry.LevelDebug)
+	sql.Register("fake", &fakeDriver{})
+	if err := Register("telemetry-fake", "fake", logger, sink,
+		WithSlowThreshold(time.Second), WithRedaction(RedactLiterals), withClock(clock)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register("telemetry-missing", "missing", logger, sink); err == nil {
+		t.Fatal("expected error registering unknown driver")
+	}
+
+	tests := []struct {
+		name     string
+		dsn      string
+		run      func(ctx context.Context, db *sql.DB) error
+		ops      map[string]int
+		errs     map[string]int
+		expected []string
+	}{
+		{
+			"exec-context",
+			"execer",
+			func(ctx context.Context, db *sql.DB) error {
+				_, err := db.ExecContext(ctx, "UPDATE users SET name = 'bob' WHERE id = 42")
+				return err
+			},
+			map[string]int{OpExec: 1}, nil, nil,
+		},
+		{
+			"exec-prepared-fallback",
+			"",
+			func(ctx context.Context, db *sql.DB) error {
+				_, err := db.ExecContext(ctx, "UPDATE users SET name = ? WHERE id = ?", "bob", 42)
+				return err
+			},
+			map[string]int{OpPrepare: 1, OpExec: 1}, nil, nil,
+		},
+		{
+			"query-slow",
+			"execer",
+			func(ctx context.Context, db *sql.DB) error {
+				rows, err := db.QueryContext(ctx, "SELECT sleep FROM users WHERE name = 'alice'")
+				if err != nil {
+					return err
+				}
+				return rows.Close()
+			},
+			map[string]int{OpQuery: 1}, nil,
+			[]string{`level=info msg="slow sql operation" err=<nil> [x-request-id abc operation query duration 2s`, `statement SELECT sleep FROM users WHERE name = ?]`},
+		},
+		{
+			"query-error",
+			"execer",
+			func(ctx context.Context, db *sql.DB) error {
+				_, err := db.QueryContext(ctx, "SELECT fail")
+				if err == nil {
+					return errors.New("expected error")
+				}
+				return nil
+			},
+			map[string]int{OpQuery: 1}, map[string]int{OpQuery: 1},
+			[]string{`level=error msg="sql operation failed" err=fail [x-request-id abc operation query duration`, `statement SELECT fail]`},
+		},
+		{
+			"transaction",
+			"execer",
+			func(ctx context.Context, db *sql.DB) error {
+				tx, err := db.BeginTx(ctx, nil)
+				if err != nil {
+					return err
+				}
+				if _, err = tx.ExecContext(ctx, "DELETE FROM users"); err != nil {
+					return err
+				}
+				if err = tx.Commit(); err != nil {
+					return err
+				}
+				if tx, err = db.BeginTx(ctx, nil); err != nil {
+					return err
+				}
+				return tx.Rollback()
+			},
+			map[string]int{OpBegin: 2, OpExec: 1, OpCommit: 1, OpRollback: 1}, nil, nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out.Reset()
+			sink.Reset(t)
+
+			db, err := sql.Open("telemetry-fake", tt.dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = db.Close() }()
+
+			ctx := telemetry.KeyValuesToContext(context.Background(), "x-request-id", "abc")
+			if err = tt.run(ctx, db); err != nil {
+				t.Fatal(err)
+			}
+
+			for op, count := range tt.ops {
+				sink.ExpectDistribution("sql_client_operation_duration_seconds", metrictest.Labels{"operation": op}).Count(count)
+			}
+			for op, count := range tt.errs {
+				sink.ExpectSum("sql_client_errors_total", metrictest.Labels{"operation": op}).Equals(float64(count))
+			}
+			if len(tt.errs) == 0 && len(sink.Observations("sql_client_errors_total")) != 0 {
+				t.Errorf("unexpected errors recorded: %v", sink.Observations("sql_client_errors_total"))
+			}
+			if tt.expected == nil && out.Len() != 0 {
+				t.Errorf("unexpected log lines: %s", out.String())
+			}
+			for _, e := range tt.expected {
+				if !strings.Contains(out.String(), e) {
+					t.Errorf("expected %s to contain %s", out.String(), e)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactLiterals(t *testing.T) {
+	have := RedactLiterals("SELECT t1.a FROM t1 WHERE b = 'it''s' AND c > 3.14 AND d = ?")
+	want := "SELECT t1.a FROM t1 WHERE b = ? AND c > ? AND d = ?"
+	if have != want {
+		t.Fatalf("RedactLiterals()=%q, want: %q", have, want)
+	}
+}
+
+// fakeDriver is an in-memory driver.Driver. Connections opened with the
+// "execer" name implement the Context aware Execer and Queryer interfaces,
+// others only support prepared statements.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	c := &fakeConn{}
+	if name == "execer" {
+		return &fakeExecerConn{c}, nil
+	}
+	return c, nil
+}
+
+type fakeConn struct{}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{query: query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+type fakeExecerConn struct {
+	*fakeConn
+}
+
+func (c *fakeExecerConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	return run(query)
+}
+
+func (c *fakeExecerConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	if _, err := run(query); err != nil {
+		return nil, err
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeStmt struct {
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) { return run(s.query) }
+
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	if _, err := run(s.query); err != nil {
+		return nil, err
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct{}
+
+func (*fakeRows) Columns() []string              { return []string{"a"} }
+func (*fakeRows) Close() error                   { return nil }
+func (*fakeRows) Next(dest []driver.Value) error { return io.EOF }
+
+// fakeClock is a clock advancing only when told to.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+var clock = &fakeClock{t: time.Unix(0, 0)}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func withClock(c *fakeClock) Option {
+	return func(o *options) {
+		o.now = c.now
+	}
+}
+
+func run(query string) (driver.Result, error) {
+	switch {
+	case strings.Contains(query, "fail"):
+		return nil, errors.New("fail")
+	case strings.Contains(query, "sleep"):
+		clock.advance(2 * time.Second)
+	}
+	return driver.RowsAffected(1), nil
+}
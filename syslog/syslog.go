@@ -0,0 +1,476 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package syslog provides function.Emit and function.EmitRecord
+// implementations sending log messages to a syslog server.
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/function"
+	"github.com/tetratelabs/telemetry/scope"
+)
+
+// Format is the syslog message format.
+type Format int
+
+// Supported syslog message formats.
+const (
+	// RFC5424 formats messages according to RFC 5424, with the key/value pairs
+	// of the log message as structured data.
+	RFC5424 Format = iota
+	// RFC3164 formats messages according to the legacy BSD syslog format,
+	// with the key/value pairs of the log message appended to the message.
+	RFC3164
+)
+
+// Facility is the syslog facility of messages.
+type Facility int
+
+// Syslog facilities.
+const (
+	FacilityKern   Facility = 0
+	FacilityUser   Facility = 1
+	FacilityDaemon Facility = 3
+	FacilityAuth   Facility = 4
+	FacilityLocal0 Facility = 16
+	FacilityLocal1 Facility = 17
+	FacilityLocal2 Facility = 18
+	FacilityLocal3 Facility = 19
+	FacilityLocal4 Facility = 20
+	FacilityLocal5 Facility = 21
+	FacilityLocal6 Facility = 22
+	FacilityLocal7 Facility = 23
+)
+
+// Syslog severities the logging levels are mapped to.
+const (
+	SeverityError = 3
+	SeverityInfo  = 6
+	SeverityDebug = 7
+)
+
+// DefaultSDID is the default ID of the RFC 5424 structured data element
+// holding the key/value pairs of log messages. It uses the enterprise number
+// reserved for documentation by RFC 5612.
+const DefaultSDID = "kv@32473"
+
+// DefaultTimeout is the default timeout for connecting to the syslog server
+// and for writing a message to it.
+const DefaultTimeout = 5 * time.Second
+
+// DefaultReconnectInterval is the default minimum interval between attempts to
+// reconnect to the syslog server.
+const DefaultReconnectInterval = time.Second
+
+// Option implements a functional option type for the Emitter.
+type Option func(*options)
+
+type options struct {
+	format   Format
+	facility Facility
+	hostname string
+	appName  string
+	sdID     string
+	timeout  time.Duration
+	interval time.Duration
+	now      func() time.Time
+	dial     func(network, address string, timeout time.Duration) (net.Conn, error)
+}
+
+// WithFormat sets the message format. By default RFC5424 is used.
+func WithFormat(format Format) Option {
+	return func(o *options) {
+		o.format = format
+	}
+}
+
+// WithFacility sets the facility of messages. By default FacilityUser is used.
+func WithFacility(facility Facility) Option {
+	return func(o *options) {
+		o.facility = facility
+	}
+}
+
+// WithHostname sets the hostname of messages. By default os.Hostname is used.
+func WithHostname(hostname string) Option {
+	return func(o *options) {
+		o.hostname = hostname
+	}
+}
+
+// WithAppName sets the application name of messages. By default the base name
+// of the program is used.
+func WithAppName(appName string) Option {
+	return func(o *options) {
+		o.appName = appName
+	}
+}
+
+// WithStructuredDataID sets the ID of the RFC 5424 structured data element
+// holding the key/value pairs of log messages. By default DefaultSDID is used.
+func WithStructuredDataID(id string) Option {
+	return func(o *options) {
+		o.sdID = id
+	}
+}
+
+// WithTimeout sets the timeout for connecting to the syslog server and for
+// writing a message to it. By default DefaultTimeout is used.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithReconnectInterval sets the minimum interval between attempts to
+// reconnect to the syslog server. By default DefaultReconnectInterval is used.
+func WithReconnectInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.interval = interval
+	}
+}
+
+// Emitter sends log messages to a syslog server. Its Emit and EmitRecord
+// methods can be used with function.NewLogger and function.NewRecordLogger
+// respectively:
+//
+//	emitter, err := syslog.Dial("udp", "localhost:514")
+//	...
+//	logger := function.NewRecordLogger(emitter.EmitRecord)
+//
+// Messages are sent as datagrams over "udp" and "unixgram" networks and with
+// octet counting framing (RFC 6587) over "tcp" and "unix" networks. The scope
+// name of the Logger is used as the RFC 5424 MSGID.
+type Emitter struct {
+	options
+	network string
+	address string
+	pid     string
+
+	mu   sync.Mutex
+	conn net.Conn
+	// dialing is set while reconnecting in the background.
+	dialing bool
+	// retryAt holds the earliest time of the next reconnection attempt.
+	retryAt time.Time
+	closed  bool
+}
+
+// Dial returns an Emitter sending log messages to the syslog server at the
+// provided address. Supported networks are "udp", "tcp", "unixgram" and
+// "unix". Dial fails if the syslog server can't be reached; once connected,
+// the Emitter reconnects on its own in the background whenever sending a
+// message fails, dropping messages until reconnected.
+func Dial(network, address string, opts ...Option) (*Emitter, error) {
+	switch network {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6", "unixgram", "unix":
+	default:
+		return nil, fmt.Errorf("syslog: unsupported network %q", network)
+	}
+
+	o := options{
+		facility: FacilityUser,
+		sdID:     DefaultSDID,
+		timeout:  DefaultTimeout,
+		interval: DefaultReconnectInterval,
+		now:      time.Now,
+		dial:     net.DialTimeout,
+	}
+	o.hostname, _ = os.Hostname()
+	if len(os.Args) > 0 {
+		o.appName = filepath.Base(os.Args[0])
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	e := &Emitter{options: o, network: network, address: address, pid: strconv.Itoa(os.Getpid())}
+	conn, err := o.dial(network, address, o.timeout)
+	if err != nil {
+		return nil, err
+	}
+	e.conn = conn
+	return e, nil
+}
+
+// Emit implements function.Emit.
+func (e *Emitter) Emit(level telemetry.Level, msg string, err error, values function.Values) {
+	name := ""
+	for i := 0; i+1 < len(values.FromLogger); i += 2 {
+		if values.FromLogger[i] == scope.Key {
+			name, _ = values.FromLogger[i+1].(string)
+		}
+	}
+	e.EmitRecord(function.Record{Time: e.now(), Level: level, Message: msg, Err: err, Name: name, Values: values})
+}
+
+// EmitRecord implements function.EmitRecord. Messages failing to be sent
+// within the timeout, or emitted while reconnecting, are dropped.
+func (e *Emitter) EmitRecord(r function.Record) {
+	var b []byte
+	if e.format == RFC3164 {
+		b = e.formatRFC3164(r)
+	} else {
+		b = e.formatRFC5424(r)
+	}
+	if e.stream() {
+		b = append([]byte(strconv.Itoa(len(b))+" "), b...)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.conn != nil {
+		if e.write(b) == nil {
+			return
+		}
+		_ = e.conn.Close()
+		e.conn = nil
+	}
+	e.reconnect()
+}
+
+// reconnect dials the syslog server in the background, unless already dialing
+// or the previous attempt failed less than the reconnect interval ago. It must
+// be called with e.mu held.
+func (e *Emitter) reconnect() {
+	if e.dialing || e.closed || time.Now().Before(e.retryAt) {
+		return
+	}
+	e.dialing = true
+	go func() {
+		conn, err := e.dial(e.network, e.address, e.timeout)
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		e.dialing = false
+		switch {
+		case err != nil:
+			e.retryAt = time.Now().Add(e.interval)
+		case e.closed:
+			_ = conn.Close()
+		default:
+			e.conn = conn
+		}
+	}()
+}
+
+// write sends b over the connection, failing if it takes longer than the
+// timeout.
+func (e *Emitter) write(b []byte) error {
+	if e.timeout > 0 {
+		if err := e.conn.SetWriteDeadline(time.Now().Add(e.timeout)); err != nil {
+			return err
+		}
+	}
+	_, err := e.conn.Write(b)
+	return err
+}
+
+// Close closes the connection to the syslog server. Messages emitted after
+// Close are dropped.
+func (e *Emitter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.closed = true
+	if e.conn == nil {
+		return nil
+	}
+	err := e.conn.Close()
+	e.conn = nil
+	return err
+}
+
+// stream returns whether messages are sent over a stream connection and need
+// framing.
+func (e *Emitter) stream() bool {
+	return e.network == "unix" || strings.HasPrefix(e.network, "tcp")
+}
+
+// priority returns the PRI part of a message at the given level.
+func (e *Emitter) priority(level telemetry.Level) string {
+	severity := SeverityDebug
+	switch {
+	case level <= telemetry.LevelError:
+		severity = SeverityError
+	case level <= telemetry.LevelInfo:
+		severity = SeverityInfo
+	}
+	return "<" + strconv.Itoa(int(e.facility)*8+severity) + ">"
+}
+
+// formatRFC5424 formats the Record as:
+//
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (e *Emitter) formatRFC5424(r function.Record) []byte {
+	var b strings.Builder
+	b.WriteString(e.priority(r.Level))
+	b.WriteString("1 ")
+	b.WriteString(r.Time.Format("2006-01-02T15:04:05.000000Z07:00"))
+	b.WriteByte(' ')
+	b.WriteString(headerField(e.hostname, 255))
+	b.WriteByte(' ')
+	b.WriteString(headerField(e.appName, 48))
+	b.WriteByte(' ')
+	b.WriteString(e.pid)
+	b.WriteByte(' ')
+	b.WriteString(headerField(r.Name, 32))
+	b.WriteByte(' ')
+
+	params := 0
+	appendParam := func(key, value string) {
+		if params == 0 {
+			b.WriteByte('[')
+			b.WriteString(sdName(e.sdID, 32))
+		}
+		params++
+		b.WriteByte(' ')
+		b.WriteString(sdName(key, 32))
+		b.WriteString(`="`)
+		b.WriteString(sdValue(value))
+		b.WriteByte('"')
+	}
+	if r.Err != nil {
+		appendParam("error", errorString(r.Err))
+	}
+	forEachKeyValue(r.Values, appendParam)
+	if params == 0 {
+		b.WriteByte('-')
+	} else {
+		b.WriteByte(']')
+	}
+
+	if r.Message != "" {
+		b.WriteByte(' ')
+		b.WriteString(r.Message)
+	}
+	return []byte(b.String())
+}
+
+// formatRFC3164 formats the Record as:
+//
+//	<PRI>TIMESTAMP HOSTNAME TAG[PID]: MSG
+func (e *Emitter) formatRFC3164(r function.Record) []byte {
+	var b strings.Builder
+	b.WriteString(e.priority(r.Level))
+	b.WriteString(r.Time.Format(time.Stamp))
+	b.WriteByte(' ')
+	if e.hostname != "" {
+		b.WriteString(headerField(e.hostname, 255))
+		b.WriteByte(' ')
+	}
+	b.WriteString(headerField(e.appName, 32))
+	b.WriteString("[" + e.pid + "]: ")
+	b.WriteString(r.Message)
+
+	appendKeyValue := func(key, value string) {
+		b.WriteByte(' ')
+		b.WriteString(key)
+		b.WriteByte('=')
+		if value == "" || strings.ContainsAny(value, " \t\r\n\"=") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(value)
+	}
+	if r.Err != nil {
+		appendKeyValue("error", errorString(r.Err))
+	}
+	forEachKeyValue(r.Values, appendKeyValue)
+	return []byte(b.String())
+}
+
+// errorString returns the message of err, or "<nil>" for typed nil errors
+// with a panicking Error method.
+func errorString(err error) (s string) {
+	defer func() {
+		if r := recover(); r != nil {
+			if v := reflect.ValueOf(err); v.Kind() == reflect.Ptr && v.IsNil() {
+				s = "<nil>"
+				return
+			}
+			s = fmt.Sprintf("%%!v(PANIC=Error method: %v)", r)
+		}
+	}()
+	return err.Error()
+}
+
+// forEachKeyValue calls f with the key/value pairs from the Context, the
+// Logger and the logging method, in that order.
+func forEachKeyValue(values function.Values, f func(key, value string)) {
+	for _, keyValues := range [][]interface{}{values.FromContext, values.FromLogger, values.FromMethod} {
+		for i := 0; i < len(keyValues); i += 2 {
+			value := "(MISSING)"
+			if i+1 < len(keyValues) {
+				value = fmt.Sprintf("%+v", keyValues[i+1])
+			}
+			f(fmt.Sprint(keyValues[i]), value)
+		}
+	}
+}
+
+// headerField returns s restricted to printable US-ASCII characters and the
+// given length, or the NILVALUE if empty.
+func headerField(s string, maxLen int) string {
+	s = printable(s, nil)
+	if len(s) > maxLen {
+		s = s[:maxLen]
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// sdName returns s as a valid structured data name.
+func sdName(s string, maxLen int) string {
+	s = printable(s, func(r rune) bool { return r == '=' || r == ']' || r == '"' })
+	if len(s) > maxLen {
+		s = s[:maxLen]
+	}
+	if s == "" {
+		return "_"
+	}
+	return s
+}
+
+// printable replaces characters which are not printable US-ASCII or are
+// rejected by invalid with an underscore.
+func printable(s string, invalid func(rune) bool) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || (invalid != nil && invalid(r)) {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// sdValueReplacer escapes the characters RFC 5424 requires to be escaped in
+// structured data parameter values.
+var sdValueReplacer = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// sdValue returns s escaped for use as structured data parameter value.
+func sdValue(s string) string { return sdValueReplacer.Replace(s) }
@@ -0,0 +1,343 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/telemetry"
+	"github.com/tetratelabs/telemetry/function"
+)
+
+var now = time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func withNow() Option {
+	return func(o *options) {
+		o.now = func() time.Time { return now }
+	}
+}
+
+func TestFormat(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	ctx := telemetry.KeyValuesToContext(context.Background(), "ctx", "value")
+
+	tests := []struct {
+		name  string
+		opts  []Option
+		logfn func(telemetry.Logger)
+		want  string
+	}{
+		{
+			"rfc5424",
+			nil,
+			func(l telemetry.Logger) { l.Info("text") },
+			"<14>1 2023-01-02T03:04:05.000000Z host app " + pid + " - - text",
+		},
+		{
+			"rfc5424 structured data",
+			[]Option{WithFacility(FacilityLocal0)},
+			func(l telemetry.Logger) {
+				l.Context(ctx).With("scope", "server").Error("text", errors.New("failed"), "a key", `q"u]o\te`)
+			},
+			"<131>1 2023-01-02T03:04:05.000000Z host app " + pid + ` server [kv@32473 error="failed" ctx="value" scope="server" a_key="q\"u\]o\\te"] text`,
+		},
+		{
+			"rfc5424 debug",
+			[]Option{WithStructuredDataID("custom@1"), WithHostname(""), WithAppName("my app")},
+			func(l telemetry.Logger) { l.Debug("text", "n", 1) },
+			"<15>1 2023-01-02T03:04:05.000000Z - my_app " + pid + ` - [custom@1 n="1"] text`,
+		},
+		{
+			"rfc3164",
+			[]Option{WithFormat(RFC3164), WithFacility(FacilityDaemon)},
+			func(l telemetry.Logger) {
+				l.With("scope", "server").Error("text", errors.New("failed"), "key", "a value")
+			},
+			"<27>Jan  2 03:04:05 host app[" + pid + `]: text error=failed scope=server key="a value"`,
+		},
+		{
+			"typed nil error",
+			[]Option{WithFormat(RFC3164)},
+			func(l telemetry.Logger) { l.Error("text", (*os.PathError)(nil)) },
+			"<11>Jan  2 03:04:05 host app[" + pid + "]: text error=<nil>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer func() { _ = conn.Close() }()
+
+			opts := append([]Option{WithHostname("host"), WithAppName("app"), withNow()}, tt.opts...)
+			e, err := Dial("udp", conn.LocalAddr().String(), opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer func() { _ = e.Close() }()
+
+			logger := function.NewLogger(e.Emit)
+			logger.SetLevel(telemetry.LevelDebug)
+			tt.logfn(logger)
+
+			if have := readPacket(t, conn); have != tt.want {
+				t.Fatalf("message=%q, want: %q", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = l.Close() }()
+
+	e, err := Dial("tcp", l.Addr().String(), WithHostname("host"), WithAppName("app"), withNow())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = e.Close() }()
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	logger := function.NewRecordLogger(e.EmitRecord, function.WithClock(func() time.Time { return now }))
+	logger.With("scope", "s").Info("first")
+	logger.Info("second\nline")
+
+	pid := strconv.Itoa(os.Getpid())
+	r := bufio.NewReader(conn)
+	for _, want := range []string{
+		"<14>1 2023-01-02T03:04:05.000000Z host app " + pid + ` s [kv@32473 scope="s"] first`,
+		"<14>1 2023-01-02T03:04:05.000000Z host app " + pid + " - - second\nline",
+	} {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		size, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if size != strconv.Itoa(len(want))+" " {
+			t.Fatalf("size=%q, want: %d", size, len(want))
+		}
+		msg := make([]byte, len(want))
+		if _, err = io.ReadFull(r, msg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(msg) != want {
+			t.Fatalf("message=%q, want: %q", msg, want)
+		}
+	}
+}
+
+func TestStalledServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = l.Close() }()
+
+	e, err := Dial("tcp", l.Addr().String(), WithTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = e.Close() }()
+
+	// accept the connection but never read from it
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		msg := strings.Repeat("x", 1<<20)
+		for i := 0; i < 64; i++ {
+			e.EmitRecord(function.Record{Time: now, Level: telemetry.LevelInfo, Message: msg})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatalf("EmitRecord blocked on a stalled server")
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = l.Close() }()
+
+	var (
+		mu      sync.Mutex
+		dials   int
+		blocked = make(chan struct{})
+	)
+	dial := func(o *options) {
+		o.dial = func(network, address string, timeout time.Duration) (net.Conn, error) {
+			mu.Lock()
+			dials++
+			n := dials
+			mu.Unlock()
+			if n == 2 {
+				// the first reconnection attempt hangs until released
+				<-blocked
+				return nil, errors.New("dial failed")
+			}
+			return net.DialTimeout(network, address, timeout)
+		}
+	}
+	e, err := Dial("tcp", l.Addr().String(), WithHostname("host"), WithAppName("app"), withNow(),
+		WithReconnectInterval(time.Millisecond), dial)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = e.Close() }()
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = conn.Close()
+
+	// messages are dropped without blocking while reconnecting
+	logger := function.NewRecordLogger(e.EmitRecord)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		logger.Info("dropped")
+		time.Sleep(time.Millisecond)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("emitting took %v while reconnecting", d)
+	}
+	mu.Lock()
+	n := dials
+	mu.Unlock()
+	if n != 2 {
+		t.Fatalf("dials=%d, want: 2", n)
+	}
+	close(blocked)
+
+	accepted := make(chan net.Conn)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+	var reconnected net.Conn
+	for reconnected == nil {
+		logger.Info("text")
+		select {
+		case reconnected = <-accepted:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	defer func() { _ = reconnected.Close() }()
+
+	logger.Info("reconnected")
+	_ = reconnected.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(reconnected)
+	for {
+		size, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(size))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		msg := make([]byte, n)
+		if _, err = io.ReadFull(r, msg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if strings.HasSuffix(string(msg), " reconnected") {
+			return
+		}
+	}
+}
+
+func TestDialFailure(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	if _, err = Dial("tcp", addr, WithTimeout(time.Second)); err == nil {
+		t.Fatalf("expected error for unreachable server")
+	}
+}
+
+func TestUnixgram(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "syslog.sock")
+	conn, err := net.ListenPacket("unixgram", addr)
+	if err != nil {
+		t.Skipf("unixgram not supported: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	e, err := Dial("unixgram", addr, WithFormat(RFC3164), WithHostname(""), WithAppName("app"), withNow())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = e.Close() }()
+
+	function.NewLogger(e.Emit).Error("text", nil)
+
+	want := "<11>Jan  2 03:04:05 app[" + strconv.Itoa(os.Getpid()) + "]: text"
+	if have := readPacket(t, conn); have != want {
+		t.Fatalf("message=%q, want: %q", have, want)
+	}
+}
+
+func TestUnsupportedNetwork(t *testing.T) {
+	if _, err := Dial("ip", "localhost"); err == nil {
+		t.Fatalf("expected error for unsupported network")
+	}
+}
+
+func readPacket(t *testing.T, conn net.PacketConn) string {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return string(buf[:n])
+}
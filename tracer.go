@@ -0,0 +1,130 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import "context"
+
+// StatusCode is an enumeration of the available Span status codes.
+type StatusCode int32
+
+// Available Span status codes.
+const (
+	// StatusUnset is the default status of a Span.
+	StatusUnset StatusCode = 0
+	// StatusOK marks a Span as explicitly successful.
+	StatusOK StatusCode = 1
+	// StatusError marks a Span as having encountered an error.
+	StatusError StatusCode = 2
+)
+
+// statusCodeToString maps each status code to its string representation.
+var statusCodeToString = map[StatusCode]string{
+	StatusUnset: "unset",
+	StatusOK:    "ok",
+	StatusError: "error",
+}
+
+// String returns the string representation of the status code.
+func (c StatusCode) String() string { return statusCodeToString[c] }
+
+// Tracer provides a simple tracing abstraction for creating Spans.
+type Tracer interface {
+	// Start creates a new Span with the provided name and key-value pairs as
+	// attributes. If the provided Context holds a Span, the new Span will be
+	// its child. The returned Context holds the new Span.
+	Start(ctx context.Context, name string, keyValuePairs ...interface{}) (context.Context, Span)
+}
+
+// Span represents a single operation within a trace.
+type Span interface {
+	// SetAttributes adds the key-value pairs as attributes to the Span.
+	SetAttributes(keyValuePairs ...interface{})
+
+	// AddEvent records a named event with key-value pairs as attributes at the
+	// current time.
+	AddEvent(name string, keyValuePairs ...interface{})
+
+	// RecordError records the error as an event of the Span. It does not change
+	// the status of the Span; use SetStatus for that.
+	RecordError(err error, keyValuePairs ...interface{})
+
+	// SetStatus sets the status of the Span with an optional description which
+	// is only used with StatusError.
+	SetStatus(code StatusCode, description string)
+
+	// End completes the Span. Calls on the Span after End are ignored.
+	End()
+
+	// IsRecording returns true if the Span is recording information. This can
+	// be used to avoid expensive computations of Span attributes.
+	IsRecording() bool
+
+	// SpanContext returns the identifying trace and span IDs of the Span.
+	SpanContext() SpanContext
+}
+
+// ContextWithSpan returns a Context holding the provided Span. Tracer
+// implementations must use this function to make Spans available to the
+// Context based helpers of this package.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, ctxSpan, span)
+}
+
+// SpanFromContext returns the Span found in the provided Context. If no Span
+// is found a noop Span is returned, so the result is always safe to use.
+func SpanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(ctxSpan).(Span); ok && span != nil {
+		return span
+	}
+	return noopSpan{}
+}
+
+// ContextWithSpanContext returns a Context holding the provided SpanContext.
+// This allows for middleware to store a SpanContext received from a remote
+// caller, e.g. through a W3C traceparent header, without an active Tracer.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, ctxSpanContext, sc)
+}
+
+// SpanContextFromContext returns the SpanContext of the Span found in the
+// provided Context. If no valid Span is found, the SpanContext stored with
+// ContextWithSpanContext is returned.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if sc := SpanFromContext(ctx).SpanContext(); sc.IsValid() {
+		return sc
+	}
+	sc, _ := ctx.Value(ctxSpanContext).(SpanContext)
+	return sc
+}
+
+// traceKeyValues is the ContextExtractor adding the trace and span IDs of the
+// SpanContext found in Context to log lines.
+func traceKeyValues(ctx context.Context) []interface{} {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return []interface{}{TraceIDKey, sc.TraceID.String(), SpanIDKey, sc.SpanID.String()}
+}
+
+type (
+	tCtxSpan        string
+	tCtxSpanContext string
+)
+
+var (
+	ctxSpan        tCtxSpan
+	ctxSpanContext tCtxSpanContext
+)
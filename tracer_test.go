@@ -0,0 +1,87 @@
+// Copyright (c) Tetrate, Inc 2023.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSpanContext(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := SpanFromContext(ctx).(noopSpan); !ok {
+		t.Fatalf("SpanFromContext()=%T, want: noopSpan", SpanFromContext(ctx))
+	}
+
+	span := &mockSpan{}
+	ctx = ContextWithSpan(ctx, span)
+	if SpanFromContext(ctx) != span {
+		t.Fatalf("SpanFromContext()=%v, want: %v", SpanFromContext(ctx), span)
+	}
+
+	ctx = ContextWithSpan(ctx, nil)
+	if _, ok := SpanFromContext(ctx).(noopSpan); !ok {
+		t.Fatalf("SpanFromContext()=%T, want: noopSpan", SpanFromContext(ctx))
+	}
+}
+
+func TestNoopTracer(t *testing.T) {
+	parent := &mockSpan{}
+	ctx := ContextWithSpan(context.Background(), parent)
+
+	ctx, span := NoopTracer().Start(ctx, "operation", "key", "value")
+	span.SetAttributes("key", "value")
+	span.AddEvent("event", "key", "value")
+	span.RecordError(errors.New("error"))
+	span.SetStatus(StatusError, "failed")
+	span.End()
+
+	if span.IsRecording() {
+		t.Fatal("expected noop Span not to be recording")
+	}
+	if SpanFromContext(ctx) != parent {
+		t.Fatal("expected parent Span to remain in Context")
+	}
+	if parent.ended {
+		t.Fatal("expected parent Span not to be ended")
+	}
+}
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		code StatusCode
+		want string
+	}{
+		{StatusUnset, "unset"},
+		{StatusOK, "ok"},
+		{StatusError, "error"},
+	}
+
+	for _, tt := range tests {
+		if tt.code.String() != tt.want {
+			t.Errorf("StatusCode(%d).String()=%s, want: %s", tt.code, tt.code.String(), tt.want)
+		}
+	}
+}
+
+type mockSpan struct {
+	noopSpan
+	sc    SpanContext
+	ended bool
+}
+
+func (m *mockSpan) End()                     { m.ended = true }
+func (m *mockSpan) SpanContext() SpanContext { return m.sc }